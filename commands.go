@@ -0,0 +1,316 @@
+/*
+Copyright 2024 Abion AB
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/zonefile"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const usage = `Usage: external-dns-abion [command]
+
+Commands:
+  serve                       start the webhook server (default)
+  zones list                  list the managed zones and their flags
+  zones export <zone>         export a zone as a BIND master file
+  zones import <zone> -f <file> [-dry-run]
+                              import a BIND master file into a zone
+  records list <zone>         list the records of a zone as external-dns endpoints
+  plan -f <changes.json>      show the diff a plan.Changes file would apply
+  apply -f <changes.json>     apply a plan.Changes file
+`
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+var errUsage = errors.New("invalid usage")
+
+// newProvider creates the provider of the commands, replaced in tests.
+var newProvider = dnsprovider.NewAbionProvider
+
+// runCommand runs an operator subcommand and returns the process exit code.
+func runCommand(config *configuration.Configuration, args []string, stdout, stderr io.Writer) int {
+	err := dispatchCommand(context.Background(), config, args, stdout)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+}
+
+func dispatchCommand(ctx context.Context, config *configuration.Configuration, args []string, stdout io.Writer) error {
+	switch {
+	case matchCommand(args, "zones", "list"):
+		return zonesListCommand(ctx, config, stdout)
+	case matchCommand(args, "zones", "export"):
+		return zonesExportCommand(ctx, config, args[2:], stdout)
+	case matchCommand(args, "zones", "import"):
+		return zonesImportCommand(ctx, config, args[2:], stdout)
+	case matchCommand(args, "records", "list"):
+		return recordsListCommand(ctx, config, args[2:], stdout)
+	case matchCommand(args, "plan"):
+		return changesCommand(ctx, config, "plan", true, args[1:], stdout)
+	case matchCommand(args, "apply"):
+		return changesCommand(ctx, config, "apply", false, args[1:], stdout)
+	default:
+		return errUsage
+	}
+}
+
+func matchCommand(args []string, command ...string) bool {
+	if len(args) < len(command) {
+		return false
+	}
+	for i, c := range command {
+		if args[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+func zonesListCommand(ctx context.Context, config *configuration.Configuration, stdout io.Writer) error {
+	provider, err := newProvider(config)
+	if err != nil {
+		return err
+	}
+
+	zones, err := provider.Zones(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ZONE\tTYPE\tSLAVE\tPENDING\tDELETED\tORGANISATION")
+	for _, zone := range zones {
+		a := zone.Attributes
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%t\t%s\n", zone.ID, a.DNSTypeDescription, a.Slave, a.Pending, a.Deleted, a.OrganisationDescription)
+	}
+	return w.Flush()
+}
+
+func zonesExportCommand(ctx context.Context, config *configuration.Configuration, args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	zoneID := dnsprovider.NormalizeDnsName(args[0])
+
+	flags := flag.NewFlagSet("zones export", flag.ContinueOnError)
+	file := flags.String("o", "-", "output file, or - for stdout")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return errUsage
+	}
+
+	provider, err := newProvider(config)
+	if err != nil {
+		return err
+	}
+
+	zone, err := provider.Client.GetZone(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+
+	defaultTTL := 0
+	if zone.Data.Attributes.Settings != nil {
+		defaultTTL = zone.Data.Attributes.Settings.TTL
+	}
+
+	out := stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	return zonefile.Write(out, zoneID, zone.Data.Attributes.Records, defaultTTL)
+}
+
+// zonesImportCommand replaces the record sets of a zone with the ones of a BIND
+// master file. Record sets of names and types not in the file are left untouched.
+func zonesImportCommand(ctx context.Context, config *configuration.Configuration, args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	zoneID := dnsprovider.NormalizeDnsName(args[0])
+
+	flags := flag.NewFlagSet("zones import", flag.ContinueOnError)
+	file := flags.String("f", "", "BIND master file, or - for stdin")
+	dryRun := flags.Bool("dry-run", false, "only show the diff, don't apply it")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *file == "" || flags.NArg() > 0 {
+		return errUsage
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	records, err := zonefile.Parse(in, zoneID, 0)
+	if err != nil {
+		return fmt.Errorf("error parsing zone file %s: %w", *file, err)
+	}
+
+	cfg := *config
+	cfg.DryRun = cfg.DryRun || *dryRun
+	provider, err := newProvider(&cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := provider.ReplaceRecordSets(ctx, zoneID, records); err != nil {
+		return err
+	}
+
+	if !cfg.DryRun {
+		fmt.Fprintf(stdout, "imported %d names into zone %s\n", len(records), zoneID)
+		return nil
+	}
+	return printDiffs(stdout, provider.DryRunReport().Diffs(), "text")
+}
+
+func recordsListCommand(ctx context.Context, config *configuration.Configuration, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	provider, err := newProvider(config)
+	if err != nil {
+		return err
+	}
+
+	endpoints, err := provider.ZoneRecords(ctx, dnsprovider.NormalizeDnsName(args[0]))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DNSNAME\tTYPE\tTTL\tTARGETS")
+	for _, ep := range endpoints {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", ep.DNSName, ep.RecordType, ep.RecordTTL, strings.Join(ep.Targets, ","))
+	}
+	return w.Flush()
+}
+
+// changesCommand applies a plan.Changes file, or only prints the computed
+// diff if dryRun is set.
+func changesCommand(ctx context.Context, config *configuration.Configuration, name string, dryRun bool, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := flags.String("f", "", "plan.Changes JSON file, or - for stdin")
+	output := flags.String("o", "text", "output format of the diff: text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" || flags.NArg() > 0 {
+		return errUsage
+	}
+
+	changes, err := readChanges(*file)
+	if err != nil {
+		return err
+	}
+
+	cfg := *config
+	cfg.DryRun = cfg.DryRun || dryRun
+	provider, err := newProvider(&cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := provider.ApplyChanges(ctx, changes); err != nil {
+		return err
+	}
+
+	if !cfg.DryRun {
+		fmt.Fprintf(stdout, "applied create: %d, updateOld: %d, updateNew: %d, delete: %d\n",
+			len(changes.Create), len(changes.UpdateOld), len(changes.UpdateNew), len(changes.Delete))
+		return nil
+	}
+
+	return printDiffs(stdout, provider.DryRunReport().Diffs(), *output)
+}
+
+func printDiffs(stdout io.Writer, diffs []*dnsprovider.ZoneDiff, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+
+	changed := false
+	for _, diff := range diffs {
+		if !diff.Empty() {
+			fmt.Fprint(stdout, diff)
+			changed = true
+		}
+	}
+	if !changed {
+		fmt.Fprintln(stdout, "no changes")
+	}
+	return nil
+}
+
+func readChanges(file string) (*plan.Changes, error) {
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	changes := &plan.Changes{}
+	if err := json.NewDecoder(in).Decode(changes); err != nil {
+		return nil, fmt.Errorf("error decoding changes from %s: %w", file, err)
+	}
+	return changes, nil
+}
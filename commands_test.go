@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/caarlos0/env/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+const testZone = "xn--bcher-kva.example"
+
+// fakeClient serves the configured zones and records the patches.
+type fakeClient struct {
+	zones   map[string]map[string]map[string][]internal.Record
+	patches []string
+}
+
+func (c *fakeClient) GetZones(ctx context.Context, page *internal.Pagination) (*internal.APIResponse[[]internal.Zone], error) {
+	var zones []internal.Zone
+	for _, id := range slices.Sorted(maps.Keys(c.zones)) {
+		zones = append(zones, internal.Zone{Type: "zone", ID: id})
+	}
+	return &internal.APIResponse[[]internal.Zone]{
+		Meta: &internal.Metadata{Pagination: &internal.Pagination{Offset: 0, Limit: page.Limit, Total: len(zones)}},
+		Data: zones,
+	}, nil
+}
+
+func (c *fakeClient) GetZone(ctx context.Context, name string) (*internal.APIResponse[*internal.Zone], error) {
+	records, ok := c.zones[name]
+	if !ok {
+		return nil, &internal.Error{Status: 404, Message: "Not Found", Zone: name}
+	}
+	return &internal.APIResponse[*internal.Zone]{
+		Data: &internal.Zone{Type: "zone", ID: name, Attributes: internal.Attributes{Records: records}},
+	}, nil
+}
+
+func (c *fakeClient) PatchZone(ctx context.Context, name string, patch internal.ZoneRequest) (*internal.APIResponse[*internal.Zone], error) {
+	c.patches = append(c.patches, name)
+	return &internal.APIResponse[*internal.Zone]{Data: &patch.Data}, nil
+}
+
+// withClient makes the commands use client instead of the Abion API.
+func withClient(t *testing.T, client internal.ApiClient) {
+	orig := newProvider
+	t.Cleanup(func() { newProvider = orig })
+	newProvider = func(config *configuration.Configuration) (*dnsprovider.AbionProvider, error) {
+		p, err := orig(config)
+		if err != nil {
+			return nil, err
+		}
+		p.Client = client
+		return p, nil
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func Test_runCommand(t *testing.T) {
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	config.ApiKey = "secret-key"
+
+	dir := t.TempDir()
+	changes := writeFile(t, dir, "changes.json", `{"Create":[{"dnsName":"mail.`+testZone+`","recordType":"A","targets":["192.0.2.2"]}]}`)
+	zoneFile := writeFile(t, dir, "zone", "mail 300 IN A 192.0.2.2\n")
+
+	testCases := []struct {
+		name     string
+		args     []string
+		exitCode int
+		stdout   []string
+		stderr   string
+		patches  []string
+	}{
+		{name: "no command", args: []string{}, exitCode: exitUsage, stderr: usage},
+		{name: "unknown command", args: []string{"records", "delete", testZone}, exitCode: exitUsage, stderr: usage},
+		{name: "missing zone", args: []string{"zones", "export"}, exitCode: exitUsage, stderr: usage},
+		{name: "missing changes file", args: []string{"plan"}, exitCode: exitUsage, stderr: usage},
+		{name: "extra argument", args: []string{"apply", "-f", changes, "now"}, exitCode: exitUsage, stderr: usage},
+		{name: "import without file", args: []string{"zones", "import", testZone, "-dry-run"}, exitCode: exitUsage, stderr: usage},
+		{name: "unknown zone", args: []string{"records", "list", "abion.test"}, exitCode: exitError, stderr: "error: api error: zone=abion.test, status=404"},
+		{
+			name:     "zones list",
+			args:     []string{"zones", "list"},
+			exitCode: exitOK,
+			stdout:   []string{"ZONE", testZone},
+		},
+		{
+			name:     "records list",
+			args:     []string{"records", "list", "BÜCHER.example"},
+			exitCode: exitOK,
+			stdout:   []string{"www." + testZone, "192.0.2.1"},
+		},
+		{
+			name:     "zones export",
+			args:     []string{"zones", "export", "Bücher.example."},
+			exitCode: exitOK,
+			stdout:   []string{"$ORIGIN " + testZone + ".", "192.0.2.1"},
+		},
+		{
+			name:     "zones import dry run",
+			args:     []string{"zones", "import", "Bücher.example.", "-f", zoneFile, "-dry-run"},
+			exitCode: exitOK,
+			stdout:   []string{"zone " + testZone + ": 1 added, 0 removed, 0 changed", "192.0.2.2"},
+		},
+		{
+			name:     "zones import",
+			args:     []string{"zones", "import", "Bücher.example.", "-f", zoneFile},
+			exitCode: exitOK,
+			stdout:   []string{"imported 1 names into zone " + testZone},
+			patches:  []string{testZone},
+		},
+		{
+			name:     "plan",
+			args:     []string{"plan", "-f", changes},
+			exitCode: exitOK,
+			stdout:   []string{"zone " + testZone + ": 1 added, 0 removed, 0 changed"},
+		},
+		{
+			name:     "apply",
+			args:     []string{"apply", "-f", changes},
+			exitCode: exitOK,
+			stdout:   []string{"applied create: 1, updateOld: 0, updateNew: 0, delete: 0"},
+			patches:  []string{testZone},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeClient{zones: map[string]map[string]map[string][]internal.Record{
+				testZone: {"www": {"A": {{Data: "192.0.2.1", TTL: 300}}}},
+			}}
+			withClient(t, client)
+
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, tc.exitCode, runCommand(&config, tc.args, &stdout, &stderr), stderr.String())
+			for _, s := range tc.stdout {
+				assert.Contains(t, stdout.String(), s)
+			}
+			if tc.stderr != "" {
+				assert.True(t, strings.HasPrefix(stderr.String(), tc.stderr), stderr.String())
+			}
+			assert.Equal(t, tc.patches, client.patches)
+		})
+	}
+}
+
+func Test_changesCommand_JSON(t *testing.T) {
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	client := &fakeClient{zones: map[string]map[string]map[string][]internal.Record{
+		testZone: {"www": {"A": {{Data: "192.0.2.1", TTL: 300}}}},
+	}}
+	withClient(t, client)
+
+	changes := writeFile(t, t.TempDir(), "changes.json", `{
+		"Create":[{"dnsName":"mail.bücher.example","recordType":"A","targets":["192.0.2.2"]}],
+		"Delete":[{"dnsName":"www.`+testZone+`","recordType":"A","targets":["192.0.2.1"]}]
+	}`)
+
+	var stdout bytes.Buffer
+	assert.NoError(t, dispatchCommand(context.Background(), &config, []string{"plan", "-f", changes, "-o", "json"}, &stdout))
+	assert.Empty(t, client.patches, "plan must not patch zones")
+
+	var diffs []dnsprovider.ZoneDiff
+	assert.NoError(t, json.NewDecoder(&stdout).Decode(&diffs))
+	if assert.Len(t, diffs, 1) {
+		assert.Equal(t, testZone, diffs[0].Zone)
+		assert.Len(t, diffs[0].Added, 1)
+		assert.Len(t, diffs[0].Removed, 1)
+		assert.Empty(t, diffs[0].Changed)
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the Abion API while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen lets a single probe call through to test if the API recovered.
+	BreakerHalfOpen
+	// BreakerOpen fails all calls with ErrCircuitOpen.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops calls to the Abion API after a number of consecutive
+// failures. After the open timeout a single probe call is let through: the
+// breaker closes if it succeeds and opens again if it fails. Only transport
+// errors, timeouts, rate limiting and server errors count as failures. A nil
+// CircuitBreaker lets all calls through.
+//
+// Every state change starts a new generation. Outcomes of calls let through in
+// an earlier generation are ignored, so a slow call started before the breaker
+// opened doesn't close it again.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	state            BreakerState
+	generation       uint64
+	failures         int
+	openedAt         time.Time
+	probing          bool
+	now              func() time.Time
+	onStateChange    func(BreakerState)
+}
+
+// NewCircuitBreaker creates a CircuitBreaker opening after failureThreshold
+// consecutive failures for openTimeout. onStateChange, if not nil, is called
+// on every state change. A failureThreshold <= 0 disables the breaker.
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration, onStateChange func(BreakerState)) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+		onStateChange:    onStateChange,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// allow returns ErrCircuitOpen if a call must not be made. Otherwise it returns
+// the generation the call is let through in, to be passed to record.
+func (b *CircuitBreaker) allow() (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.halfOpenAfterTimeout()
+
+	switch b.state {
+	case BreakerOpen:
+		return 0, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return 0, ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return b.generation, nil
+}
+
+// record updates the breaker with the outcome of a call let through by allow
+// in the given generation. Outcomes of earlier generations are ignored.
+func (b *CircuitBreaker) record(generation uint64, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !isBreakerFailure(err) {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		b.open()
+	}
+}
+
+// open opens the breaker. It becomes half-open after the open timeout even
+// without further calls, so the state reported to onStateChange is current.
+func (b *CircuitBreaker) open() {
+	b.openedAt = b.now()
+	b.setState(BreakerOpen)
+
+	generation := b.generation
+	time.AfterFunc(b.openTimeout, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.generation == generation {
+			b.halfOpenAfterTimeout()
+		}
+	})
+}
+
+func (b *CircuitBreaker) halfOpenAfterTimeout() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.generation++
+	if b.onStateChange != nil {
+		b.onStateChange(state)
+	}
+}
+
+// isBreakerFailure returns true for errors indicating that the API is
+// unavailable. Errors caused by the request, e.g. an unknown zone, do not count.
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return errors.Is(err, ErrServer) || errors.Is(err, ErrRateLimited)
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CircuitBreaker(t *testing.T) {
+	now := time.Now()
+	var states []BreakerState
+	b := NewCircuitBreaker(2, time.Minute, func(s BreakerState) { states = append(states, s) })
+	b.now = func() time.Time { return now }
+
+	serverErr := &Error{Status: 503, Message: "Service Unavailable"}
+	notFound := &Error{Status: 404, Message: "Zone not found"}
+
+	// request errors do not count as failures
+	b.record(allowed(t, b), serverErr)
+	b.record(allowed(t, b), notFound)
+	b.record(allowed(t, b), serverErr)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// consecutive failures open the breaker
+	b.record(allowed(t, b), errors.New("connection refused"))
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.ErrorIs(t, allowErr(b), ErrCircuitOpen)
+
+	// a single probe is let through after the open timeout
+	now = now.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	probe := allowed(t, b)
+	assert.ErrorIs(t, allowErr(b), ErrCircuitOpen)
+
+	// a cancelled probe keeps the breaker half-open
+	b.record(probe, context.Canceled)
+	probe = allowed(t, b)
+
+	// a failed probe opens the breaker again
+	b.record(probe, serverErr)
+	assert.ErrorIs(t, allowErr(b), ErrCircuitOpen)
+
+	// a successful probe closes the breaker
+	now = now.Add(time.Minute)
+	b.record(allowed(t, b), nil)
+	assert.Equal(t, BreakerClosed, b.State())
+	allowed(t, b)
+
+	assert.Equal(t, []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}, states)
+}
+
+func Test_CircuitBreaker_Disabled(t *testing.T) {
+	b := NewCircuitBreaker(0, time.Minute, nil)
+	assert.Nil(t, b)
+	b.record(allowed(t, b), errors.New("connection refused"))
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func Test_CircuitBreaker_OpenTimeout(t *testing.T) {
+	states := make(chan BreakerState, 2)
+	b := NewCircuitBreaker(1, 10*time.Millisecond, func(s BreakerState) { states <- s })
+
+	b.record(allowed(t, b), errors.New("connection refused"))
+	assert.Equal(t, BreakerOpen, <-states)
+
+	// the breaker becomes half-open without further calls
+	select {
+	case state := <-states:
+		assert.Equal(t, BreakerHalfOpen, state)
+	case <-time.After(time.Second):
+		t.Fatal("breaker not half-open after the open timeout")
+	}
+}
+
+func Test_CircuitBreaker_LateSuccess(t *testing.T) {
+	slow := make(chan struct{})
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// the first call succeeds after the second one opened the breaker
+			<-slow
+			_, _ = w.Write([]byte(`{"data":{"type":"zone","id":"abion.test"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewAbionClient("secret-key")
+	client.baseURL, _ = url.Parse(server.URL)
+	client.Breaker = NewCircuitBreaker(1, time.Minute, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := client.GetZone(context.Background(), "abion.test")
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	_, err := client.GetZone(context.Background(), "abion.test")
+	assert.ErrorIs(t, err, ErrServer)
+	assert.Equal(t, BreakerOpen, client.Breaker.State())
+
+	close(slow)
+	wg.Wait()
+
+	// the success of the call started before the breaker opened is ignored
+	assert.Equal(t, BreakerOpen, client.Breaker.State())
+	_, err = client.GetZone(context.Background(), "abion.test")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+// allowed returns the generation of a call let through by the breaker.
+func allowed(t *testing.T, b *CircuitBreaker) uint64 {
+	generation, err := b.allow()
+	assert.NoError(t, err)
+	return generation
+}
+
+func allowErr(b *CircuitBreaker) error {
+	_, err := b.allow()
+	return err
+}
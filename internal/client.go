@@ -12,18 +12,34 @@ import (
 
 	querystring "github.com/google/go-querystring/query"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // defaultBaseURL represents the API endpoint to call.
 const defaultBaseURL = "https://api.abion.com"
 
-const apiKeyHeader = "X-API-KEY"
+const (
+	apiKeyHeader    = "X-API-KEY"
+	requestIDHeader = "X-Request-ID"
+)
+
+const (
+	attributeZone         = "abion.zone"
+	attributeInvocationID = "abion.invocation_id"
+)
+
+var tracer = otel.Tracer("github.com/abiondevelopment/external-dns-webhook-abion/internal")
 
 // Client the Abion API client.
 type Client struct {
 	apiKey     string
 	baseURL    *url.URL
 	HTTPClient *http.Client
+	Breaker    *CircuitBreaker
 }
 
 type ApiClient interface {
@@ -49,8 +65,19 @@ func NewAbionClientWithTimeout(apiKey string, timeout time.Duration) *Client {
 	}
 }
 
+// NewAbionClientWithTransport creates a new Client with a configurable HTTP
+// timeout and transport for calls to the Abion API.
+func NewAbionClientWithTransport(apiKey string, timeout time.Duration, transport http.RoundTripper) *Client {
+	client := NewAbionClientWithTimeout(apiKey, timeout)
+	client.HTTPClient.Transport = transport
+	return client
+}
+
 // GetZones Lists all the zones your session can access.
 func (c *Client) GetZones(ctx context.Context, page *Pagination) (*APIResponse[[]Zone], error) {
+	ctx, span := tracer.Start(ctx, "Client.GetZones", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
 	endpoint := c.baseURL.JoinPath("v1", "zones")
 
 	req, err := newJSONRequest(ctx, http.MethodGet, endpoint, http.NoBody)
@@ -70,7 +97,7 @@ func (c *Client) GetZones(ctx context.Context, page *Pagination) (*APIResponse[[
 	results := &APIResponse[[]Zone]{}
 
 	if err := c.do(req, results); err != nil {
-		log.Errorf("could not get zones: %s", err)
+		log.WithContext(ctx).Errorf("could not get zones: %s", err)
 		return nil, err
 	}
 
@@ -79,6 +106,10 @@ func (c *Client) GetZones(ctx context.Context, page *Pagination) (*APIResponse[[
 
 // GetZone Returns the full information on a single zone
 func (c *Client) GetZone(ctx context.Context, name string) (*APIResponse[*Zone], error) {
+	ctx, span := tracer.Start(ctx, "Client.GetZone", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String(attributeZone, name)))
+	defer span.End()
+
 	endpoint := c.baseURL.JoinPath("v1", "zones", name)
 
 	req, err := newJSONRequest(ctx, http.MethodGet, endpoint, http.NoBody)
@@ -89,7 +120,7 @@ func (c *Client) GetZone(ctx context.Context, name string) (*APIResponse[*Zone],
 	results := &APIResponse[*Zone]{}
 
 	if err := c.do(req, results); err != nil {
-		return nil, fmt.Errorf("could not get zone %s: %w", name, err)
+		return nil, fmt.Errorf("could not get zone %s: %w", name, withZone(err, name))
 	}
 
 	return results, nil
@@ -97,6 +128,10 @@ func (c *Client) GetZone(ctx context.Context, name string) (*APIResponse[*Zone],
 
 // PatchZone Updates a zone by patching it according to JSON Merge Patch format (RFC 7396).
 func (c *Client) PatchZone(ctx context.Context, name string, patch ZoneRequest) (*APIResponse[*Zone], error) {
+	ctx, span := tracer.Start(ctx, "Client.PatchZone", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String(attributeZone, name)))
+	defer span.End()
+
 	endpoint := c.baseURL.JoinPath("v1", "zones", name)
 
 	req, err := newJSONRequest(ctx, http.MethodPatch, endpoint, patch)
@@ -107,13 +142,40 @@ func (c *Client) PatchZone(ctx context.Context, name string, patch ZoneRequest)
 	results := &APIResponse[*Zone]{}
 
 	if err := c.do(req, results); err != nil {
-		return nil, fmt.Errorf("could not update zone %s: %w", name, err)
+		return nil, fmt.Errorf("could not update zone %s: %w", name, withZone(err, name))
 	}
 
 	return results, nil
 }
 
+// do sends the request and annotates the span of the request context with
+// the outcome of the call.
 func (c *Client) do(req *http.Request, result any) error {
+	span := trace.SpanFromContext(req.Context())
+	generation, err := c.Breaker.allow()
+	if err == nil {
+		err = c.send(req, result)
+		c.Breaker.record(generation, err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if r, ok := result.(invocationIDer); ok {
+		if id := r.invocationID(); id != "" {
+			span.SetAttributes(attribute.String(attributeInvocationID, id))
+		}
+	}
+	return err
+}
+
+func (c *Client) send(req *http.Request, result any) error {
+	span := trace.SpanFromContext(req.Context())
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+	)
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
 	req.Header.Set(apiKeyHeader, c.apiKey)
 
 	resp, err := c.HTTPClient.Do(req)
@@ -123,6 +185,7 @@ func (c *Client) do(req *http.Request, result any) error {
 
 	defer func() { _ = resp.Body.Close() }()
 
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	if resp.StatusCode != http.StatusOK {
 		return parseError(req, resp)
 	}
@@ -161,6 +224,10 @@ func newJSONRequest(ctx context.Context, method string, endpoint *url.URL, paylo
 
 	req.Header.Set("Accept", "application/json")
 
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+
 	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -172,11 +239,15 @@ func parseError(req *http.Request, resp *http.Response) error {
 	raw, _ := io.ReadAll(resp.Body)
 
 	zResp := &APIResponse[any]{}
-	err := json.Unmarshal(raw, zResp)
-	if err != nil {
-		log.Errorf("error parsing error %s", err)
-		return err
+	if err := json.Unmarshal(raw, zResp); err != nil {
+		log.WithContext(req.Context()).Debugf("error response with status %d is not JSON: %s", resp.StatusCode, err)
+		zResp = &APIResponse[any]{}
+	}
+
+	id := zResp.invocationID()
+	if id != "" {
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.String(attributeInvocationID, id))
 	}
 
-	return zResp.Error
+	return newError(req.Method, resp.StatusCode, raw, zResp.Error, id)
 }
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_Client_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+
+	testCases := []struct {
+		name       string
+		status     int
+		body       string
+		attributes []attribute.KeyValue
+		err        bool
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			body:   `{"meta":{"invocationId":"inv-1"},"data":{"type":"zone","id":"abion.test"}}`,
+			attributes: []attribute.KeyValue{
+				attribute.String(attributeZone, "abion.test"),
+				attribute.String("http.request.method", http.MethodGet),
+				attribute.String("url.path", "/v1/zones/abion.test"),
+				attribute.Int("http.response.status_code", http.StatusOK),
+				attribute.String(attributeInvocationID, "inv-1"),
+			},
+		},
+		{
+			name:   "api error",
+			status: http.StatusNotFound,
+			body:   `{"meta":{"invocationId":"inv-2"},"error":{"status":404,"message":"Not Found"}}`,
+			attributes: []attribute.KeyValue{
+				attribute.String(attributeZone, "abion.test"),
+				attribute.Int("http.response.status_code", http.StatusNotFound),
+				attribute.String(attributeInvocationID, "inv-2"),
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var traceparent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceparent = r.Header.Get("traceparent")
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := NewAbionClient("secret-key")
+			client.baseURL, _ = url.Parse(server.URL)
+
+			_, err := client.GetZone(context.Background(), "abion.test")
+			assert.Equal(t, tc.err, err != nil, err)
+
+			spans := recorder.Ended()
+			if !assert.NotEmpty(t, spans) {
+				return
+			}
+			span := spans[len(spans)-1]
+			assert.Equal(t, "Client.GetZone", span.Name())
+			assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+			for _, attr := range tc.attributes {
+				assert.Contains(t, span.Attributes(), attr)
+			}
+			if tc.err {
+				assert.Equal(t, codes.Error, span.Status().Code)
+			} else {
+				assert.Equal(t, codes.Unset, span.Status().Code)
+			}
+			assert.Contains(t, traceparent, span.SpanContext().TraceID().String(), "the trace context is sent to the Abion API")
+		})
+	}
+}
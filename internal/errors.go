@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBodyLength limits the part of a non-JSON error body kept as message.
+const maxErrorBodyLength = 512
+
+// Sentinel errors for the failure classes of the Abion API. An *Error matches
+// the sentinel of its HTTP status with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+	ErrValidation   = errors.New("validation failed")
+)
+
+// Error is an error response of the Abion API. Status and Message are decoded
+// from the response body, the remaining fields describe the failed call.
+type Error struct {
+	Status       int    `json:"status"`
+	Message      string `json:"message"`
+	InvocationID string `json:"-"`
+	Method       string `json:"-"`
+	Zone         string `json:"-"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("api error: ")
+	if e.Method != "" {
+		fmt.Fprintf(&b, "method=%s, ", e.Method)
+	}
+	if e.Zone != "" {
+		fmt.Fprintf(&b, "zone=%s, ", e.Zone)
+	}
+	fmt.Fprintf(&b, "status=%d, message=%s", e.Status, e.Message)
+	if e.InvocationID != "" {
+		fmt.Fprintf(&b, ", invocationId=%s", e.InvocationID)
+	}
+	return b.String()
+}
+
+// Unwrap returns the sentinel error of the status, or nil if there is none.
+func (e *Error) Unwrap() error {
+	switch {
+	case e.Status == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.Status == http.StatusForbidden:
+		return ErrForbidden
+	case e.Status == http.StatusNotFound:
+		return ErrNotFound
+	case e.Status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.Status == http.StatusBadRequest || e.Status == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case e.Status >= http.StatusInternalServerError:
+		return ErrServer
+	default:
+		return nil
+	}
+}
+
+// newError creates the Error of a failed call from the response status and
+// body. Bodies that are not a JSON API error are kept as message.
+func newError(method string, status int, body []byte, apiErr *Error, invocationID string) *Error {
+	e := &Error{Status: status, Method: method, InvocationID: invocationID}
+	if apiErr != nil {
+		e.Message = apiErr.Message
+		if apiErr.Status != 0 {
+			e.Status = apiErr.Status
+		}
+	}
+	if e.Message == "" {
+		e.Message = errorBodyMessage(status, body)
+	}
+	return e
+}
+
+func errorBodyMessage(status int, body []byte) string {
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return http.StatusText(status)
+	}
+	if len(msg) > maxErrorBodyLength {
+		msg = msg[:maxErrorBodyLength] + "..."
+	}
+	return msg
+}
+
+// withZone sets the zone of an API error wrapped by err.
+func withZone(err error, zone string) error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Zone == "" {
+		apiErr.Zone = zone
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetZone_Errors(t *testing.T) {
+	type testCase struct {
+		name     string
+		status   int
+		body     string
+		expected struct {
+			sentinel error
+			apiErr   Error
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:   "json error body",
+			status: http.StatusNotFound,
+			body:   `{"meta":{"invocationId":"inv-1"},"error":{"status":404,"message":"Zone not found"}}`,
+			expected: struct {
+				sentinel error
+				apiErr   Error
+			}{
+				sentinel: ErrNotFound,
+				apiErr:   Error{Status: 404, Message: "Zone not found", InvocationID: "inv-1", Method: http.MethodGet, Zone: "abion.test"},
+			},
+		},
+		{
+			name:   "json body without error",
+			status: http.StatusForbidden,
+			body:   `{"meta":{"invocationId":"inv-2"}}`,
+			expected: struct {
+				sentinel error
+				apiErr   Error
+			}{
+				sentinel: ErrForbidden,
+				apiErr:   Error{Status: 403, Message: `{"meta":{"invocationId":"inv-2"}}`, InvocationID: "inv-2", Method: http.MethodGet, Zone: "abion.test"},
+			},
+		},
+		{
+			name:   "non-json body",
+			status: http.StatusBadGateway,
+			body:   "<html>Bad Gateway</html>",
+			expected: struct {
+				sentinel error
+				apiErr   Error
+			}{
+				sentinel: ErrServer,
+				apiErr:   Error{Status: 502, Message: "<html>Bad Gateway</html>", Method: http.MethodGet, Zone: "abion.test"},
+			},
+		},
+		{
+			name:   "empty body",
+			status: http.StatusTooManyRequests,
+			expected: struct {
+				sentinel error
+				apiErr   Error
+			}{
+				sentinel: ErrRateLimited,
+				apiErr:   Error{Status: 429, Message: "Too Many Requests", Method: http.MethodGet, Zone: "abion.test"},
+			},
+		},
+		{
+			name:   "validation error",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"status":400,"message":"invalid rdata"}}`,
+			expected: struct {
+				sentinel error
+				apiErr   Error
+			}{
+				sentinel: ErrValidation,
+				apiErr:   Error{Status: 400, Message: "invalid rdata", Method: http.MethodGet, Zone: "abion.test"},
+			},
+		},
+		{
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"status":401,"message":"Unauthorized"}}`,
+			expected: struct {
+				sentinel error
+				apiErr   Error
+			}{
+				sentinel: ErrUnauthorized,
+				apiErr:   Error{Status: 401, Message: "Unauthorized", Method: http.MethodGet, Zone: "abion.test"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := NewAbionClient("secret")
+			client.baseURL, _ = url.Parse(server.URL)
+
+			_, err := client.GetZone(context.Background(), "abion.test")
+			assert.ErrorIs(t, err, tc.expected.sentinel)
+
+			var apiErr *Error
+			if assert.True(t, errors.As(err, &apiErr)) {
+				assert.Equal(t, tc.expected.apiErr, *apiErr)
+			}
+		})
+	}
+}
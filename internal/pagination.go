@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrPaginationStalled is returned when a page of a listing is empty although
+	// the API reports more results, which would otherwise make the listing loop forever.
+	ErrPaginationStalled = errors.New("pagination stalled")
+	// ErrPaginationMissing is returned when a page of a listing has no pagination
+	// metadata although more results may follow.
+	ErrPaginationMissing = errors.New("pagination metadata missing")
+)
+
+// ZonesIter returns an iterator over all zones accessible by the client. Zones are
+// requested in pages of pageSize zones, a pageSize <= 0 leaves the page size
+// up to the API. The iteration stops after the first error, which is yielded
+// with an empty Zone, and early when ctx is cancelled.
+//
+// A first page without pagination metadata that is not full is treated as the
+// complete listing. Pages without pagination metadata after the first one or
+// full first pages fail the iteration with ErrPaginationMissing, instead of
+// silently dropping the remaining zones.
+func ZonesIter(ctx context.Context, client ApiClient, pageSize int) iter.Seq2[Zone, error] {
+	return func(yield func(Zone, error) bool) {
+		offset := 0
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(Zone{}, err)
+				return
+			}
+
+			page := &Pagination{Offset: offset, Limit: max(pageSize, 0)}
+			resp, err := client.GetZones(ctx, page)
+			if err != nil {
+				yield(Zone{}, err)
+				return
+			}
+
+			for _, zone := range resp.Data {
+				if !yield(zone, nil) {
+					return
+				}
+			}
+
+			if resp.Meta == nil || resp.Meta.Pagination == nil {
+				if offset > 0 || (pageSize > 0 && len(resp.Data) >= pageSize) {
+					yield(Zone{}, fmt.Errorf("%w: zones page at offset %d", ErrPaginationMissing, offset))
+					return
+				}
+				log.WithContext(ctx).Warnf("zones response has no pagination metadata, assuming all %d zones are listed", len(resp.Data))
+				return
+			}
+
+			total := resp.Meta.Total
+			offset += len(resp.Data)
+			if offset >= total {
+				return
+			}
+			if len(resp.Data) == 0 {
+				yield(Zone{}, fmt.Errorf("%w: empty zones page at offset %d of %d", ErrPaginationStalled, offset, total))
+				return
+			}
+		}
+	}
+}
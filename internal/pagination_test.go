@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pagingClient serves the configured zones in pages according to the requested
+// offset and limit. Pages after stallAt are empty, noMeta omits the metadata
+// of all pages and noMetaAt of the pages from the offset on.
+type pagingClient struct {
+	zones        []Zone
+	total        int
+	stallAt      int
+	noMeta       bool
+	noMetaAt     int
+	pages        []Pagination
+	cancelOnPage context.CancelFunc
+}
+
+func (c *pagingClient) GetZones(ctx context.Context, page *Pagination) (*APIResponse[[]Zone], error) {
+	c.pages = append(c.pages, *page)
+	if c.cancelOnPage != nil {
+		c.cancelOnPage()
+	}
+
+	var data []Zone
+	if c.stallAt == 0 || page.Offset < c.stallAt {
+		end := len(c.zones)
+		if page.Limit > 0 {
+			end = min(page.Offset+page.Limit, end)
+		}
+		data = c.zones[min(page.Offset, end):end]
+	}
+	resp := &APIResponse[[]Zone]{Data: data}
+	if !c.noMeta && (c.noMetaAt == 0 || page.Offset < c.noMetaAt) {
+		resp.Meta = &Metadata{
+			Pagination: &Pagination{Offset: page.Offset, Limit: page.Limit, Total: c.total},
+		}
+	}
+	return resp, nil
+}
+
+func (c *pagingClient) GetZone(ctx context.Context, name string) (*APIResponse[*Zone], error) {
+	return nil, nil
+}
+
+func (c *pagingClient) PatchZone(ctx context.Context, name string, patch ZoneRequest) (*APIResponse[*Zone], error) {
+	return nil, nil
+}
+
+func zoneIDs(ctx context.Context, client ApiClient, pageSize int) ([]string, error) {
+	var ids []string
+	for zone, err := range ZonesIter(ctx, client, pageSize) {
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, zone.ID)
+	}
+	return ids, nil
+}
+
+func Test_ZonesIter(t *testing.T) {
+	zones := []Zone{{ID: "a.com"}, {ID: "b.com"}, {ID: "c.com"}, {ID: "d.com"}, {ID: "e.com"}}
+
+	testCases := []struct {
+		name     string
+		client   *pagingClient
+		pageSize int
+		zoneIDs  []string
+		pages    []Pagination
+		err      error
+	}{
+		{
+			name:     "multiple pages",
+			client:   &pagingClient{zones: zones, total: 5},
+			pageSize: 2,
+			zoneIDs:  []string{"a.com", "b.com", "c.com", "d.com", "e.com"},
+			pages:    []Pagination{{Offset: 0, Limit: 2}, {Offset: 2, Limit: 2}, {Offset: 4, Limit: 2}},
+		},
+		{
+			name:    "page size of the api",
+			client:  &pagingClient{zones: zones, total: 5},
+			zoneIDs: []string{"a.com", "b.com", "c.com", "d.com", "e.com"},
+			pages:   []Pagination{{Offset: 0, Limit: 0}},
+		},
+		{
+			name:     "missing metadata of a complete listing",
+			client:   &pagingClient{zones: zones, noMeta: true},
+			pageSize: 10,
+			zoneIDs:  []string{"a.com", "b.com", "c.com", "d.com", "e.com"},
+			pages:    []Pagination{{Offset: 0, Limit: 10}},
+		},
+		{
+			name:     "missing metadata of a full first page",
+			client:   &pagingClient{zones: zones, noMeta: true},
+			pageSize: 2,
+			zoneIDs:  []string{"a.com", "b.com"},
+			pages:    []Pagination{{Offset: 0, Limit: 2}},
+			err:      ErrPaginationMissing,
+		},
+		{
+			name:     "missing metadata after the first page",
+			client:   &pagingClient{zones: zones, total: 5, noMetaAt: 2},
+			pageSize: 2,
+			zoneIDs:  []string{"a.com", "b.com", "c.com", "d.com"},
+			pages:    []Pagination{{Offset: 0, Limit: 2}, {Offset: 2, Limit: 2}},
+			err:      ErrPaginationMissing,
+		},
+		{
+			name:     "empty page before total",
+			client:   &pagingClient{zones: zones, total: 7, stallAt: 4},
+			pageSize: 2,
+			zoneIDs:  []string{"a.com", "b.com", "c.com", "d.com"},
+			pages:    []Pagination{{Offset: 0, Limit: 2}, {Offset: 2, Limit: 2}, {Offset: 4, Limit: 2}},
+			err:      ErrPaginationStalled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ids, err := zoneIDs(context.Background(), tc.client, tc.pageSize)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.zoneIDs, ids)
+			assert.Equal(t, tc.pages, tc.client.pages)
+		})
+	}
+}
+
+func Test_ZonesIter_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &pagingClient{zones: []Zone{{ID: "a.com"}, {ID: "b.com"}}, total: 2, cancelOnPage: cancel}
+	_, err := zoneIDs(ctx, client, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, client.pages, 1)
+}
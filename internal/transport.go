@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TransportConfig holds the settings of the HTTP transport used for the calls
+// to the Abion API.
+type TransportConfig struct {
+	// ProxyURL is the proxy for all calls. If empty, the proxy is taken from the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+	// CAFile is a PEM bundle of CA certificates trusted in addition to the system roots.
+	CAFile string
+	// TLSMinVersion is the minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3.
+	TLSMinVersion string
+	// MaxIdleConnsPerHost is the maximum number of idle keep-alive connections
+	// to the API. Zero uses the net/http default of 2.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle keep-alive connection is kept. Zero means no limit.
+	IdleConnTimeout time.Duration
+	// HTTP2 enables HTTP/2 if supported by the API.
+	HTTP2 bool
+}
+
+// NewTransport creates the HTTP transport for the configuration.
+func NewTransport(config TransportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = http.ProxyFromEnvironment
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLSMinVersion != "" {
+		version, ok := tlsVersions[config.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS min version %q", config.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if config.CAFile != "" {
+		pool, err := certPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = config.IdleConnTimeout
+
+	transport.ForceAttemptHTTP2 = config.HTTP2
+	if !config.HTTP2 {
+		// a non-nil, empty map disables the automatic HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return transport, nil
+}
+
+// certPool returns the system cert pool extended by the certificates of the
+// PEM file.
+func certPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return pool, nil
+}
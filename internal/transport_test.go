@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewTransport(t *testing.T) {
+	transport, err := NewTransport(TransportConfig{
+		ProxyURL:            "http://proxy.abion.test:3128",
+		TLSMinVersion:       "1.3",
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     time.Minute,
+	})
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, defaultBaseURL, http.NoBody)
+	proxyURL, err := transport.Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.abion.test:3128", proxyURL.String())
+	assert.Equal(t, uint16(tls.VersionTLS13), transport.TLSClientConfig.MinVersion)
+	assert.Equal(t, 20, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSNextProto)
+}
+
+func Test_NewTransport_Invalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config TransportConfig
+	}{
+		{"tls version", TransportConfig{TLSMinVersion: "1.4"}},
+		{"proxy url", TransportConfig{ProxyURL: "://proxy"}},
+		{"missing ca file", TransportConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewTransport(tc.config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_NewTransport_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"id":"abion.test"}}`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, certPEM, 0o600))
+
+	transport, err := NewTransport(TransportConfig{CAFile: caFile, HTTP2: true})
+	assert.NoError(t, err)
+
+	client := NewAbionClientWithTransport("secret", time.Second, transport)
+	client.baseURL, _ = url.Parse(server.URL)
+
+	zone, err := client.GetZone(context.Background(), "abion.test")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "abion.test", zone.Data.ID)
+	}
+}
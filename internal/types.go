@@ -1,15 +1,13 @@
 package internal
 
-import "fmt"
-
 type ZoneRequest struct {
 	Data Zone `json:"data,omitempty"`
 }
 
 type Pagination struct {
-	Offset int `json:"offset,omitempty" url:"offset"`
-	Limit  int `json:"limit,omitempty" url:"limit"`
-	Total  int `json:"total,omitempty" url:"total"`
+	Offset int `json:"offset,omitempty" url:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty" url:"limit,omitempty"`
+	Total  int `json:"total,omitempty" url:"-"`
 }
 
 type APIResponse[T any] struct {
@@ -18,6 +16,17 @@ type APIResponse[T any] struct {
 	Error *Error    `json:"error,omitempty"`
 }
 
+type invocationIDer interface {
+	invocationID() string
+}
+
+func (r *APIResponse[T]) invocationID() string {
+	if r == nil || r.Meta == nil {
+		return ""
+	}
+	return r.Meta.InvocationID
+}
+
 type Metadata struct {
 	InvocationID string `json:"invocationId,omitempty"`
 	*Pagination
@@ -61,12 +70,3 @@ type Redirect struct {
 	Slugs       bool   `json:"slugs"`
 	Certificate bool   `json:"certificate"`
 }
-
-type Error struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-}
-
-func (e *Error) Error() string {
-	return fmt.Sprintf("api error: status=%d, message=%s", e.Status, e.Message)
-}
@@ -17,14 +17,19 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
 
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
 
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/admin"
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/server"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -36,14 +41,30 @@ const banner = `
 var Version = "v0.0.1"
 
 func main() {
-	fmt.Printf(banner, Version)
 	config := configuration.Init()
 	logging.Init(&config)
 
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(&config, os.Args[1:], os.Stdout, os.Stderr))
+	}
+
+	fmt.Printf(banner, Version)
+	shutdownTracing, err := tracing.Init(context.Background(), &config, Version)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	provider, err := dnsprovider.NewAbionProvider(&config)
 	if err != nil {
 		log.Fatalf("Failed to initialize DNS provider: %v", err)
 	}
-	srv := server.Init(config, webhook.New(provider))
-	server.ShutdownGracefully(srv)
+	servers := []*http.Server{server.Init(config, webhook.New(provider))}
+	if config.AdminEnabled {
+		servers = append(servers, server.InitAdmin(config, admin.New(provider, config)))
+	}
+	server.ShutdownGracefully(servers...)
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Errorf("error shutting down tracing: %v", err)
+	}
 }
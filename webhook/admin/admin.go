@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	contentTypeHeader = "Content-Type"
+	contentTypeJSON   = "application/json"
+)
+
+// Admin serves the operator endpoints of the webhook. They are exposed on a
+// separate listen address and are disabled by default.
+type Admin struct {
+	provider *dnsprovider.AbionProvider
+	config   configuration.Configuration
+}
+
+// New creates a new instance of Admin
+func New(provider *dnsprovider.AbionProvider, config configuration.Configuration) *Admin {
+	return &Admin{provider: provider, config: config}
+}
+
+type errorResponse struct {
+	Reason string `json:"reason"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+type zoneResponse struct {
+	ID           string `json:"id"`
+	Type         string `json:"type,omitempty"`
+	Organisation string `json:"organisation,omitempty"`
+	Slave        bool   `json:"slave"`
+	Pending      bool   `json:"pending"`
+	Deleted      bool   `json:"deleted"`
+}
+
+type dryRunResponse struct {
+	Time  *time.Time                `json:"time,omitempty"`
+	Zones []dnsprovider.DiffSummary `json:"zones"`
+}
+
+// DryRun returns the change counts per zone computed by the latest dry-run apply
+func (a *Admin) DryRun(w http.ResponseWriter, r *http.Request) {
+	t, summaries := a.provider.DryRunReport().Summaries()
+	resp := dryRunResponse{Zones: summaries}
+	if !t.IsZero() {
+		resp.Time = &t
+	}
+	if resp.Zones == nil {
+		resp.Zones = []dnsprovider.DiffSummary{}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// GetLogLevel returns the current log level
+func (a *Admin) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, logLevel{Level: logging.Level()})
+}
+
+// SetLogLevel changes the log level at runtime. The change is not persisted and
+// is reverted to the level set by ABION_DEBUG on restart.
+func (a *Admin) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Reason: "error decoding log level: " + err.Error()})
+		return
+	}
+	if err := logging.SetLevel(req.Level); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Reason: err.Error()})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, logLevel{Level: logging.Level()})
+}
+
+// FlushCache clears the cached zones and dry-run report, forcing the next sync to
+// re-read the zones from the Abion API
+func (a *Admin) FlushCache(w http.ResponseWriter, r *http.Request) {
+	a.provider.FlushCache()
+	log.Info("admin: zone cache flushed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Zones returns the currently managed zones and their flags
+func (a *Admin) Zones(w http.ResponseWriter, r *http.Request) {
+	zones, err := a.provider.Zones(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("admin: error listing zones: %v", err)
+		writeJSON(w, r, http.StatusBadGateway, errorResponse{Reason: err.Error()})
+		return
+	}
+
+	resp := make([]zoneResponse, 0, len(zones))
+	for _, z := range zones {
+		resp = append(resp, zoneResponse{
+			ID:           z.ID,
+			Type:         z.Attributes.DNSTypeDescription,
+			Organisation: z.Attributes.OrganisationDescription,
+			Slave:        z.Attributes.Slave,
+			Pending:      z.Attributes.Pending,
+			Deleted:      z.Attributes.Deleted,
+		})
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// Config returns the effective configuration with secrets redacted
+func (a *Admin) Config(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, a.config.Redacted())
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithFields(log.Fields{"requestMethod": r.Method, "requestPath": r.URL.Path}).
+			Errorf("error writing admin response: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OutcomeApplied = "applied"
+	OutcomeFailed  = "failed"
+	OutcomeDryRun  = "dry-run"
+
+	stdoutPath = "stdout"
+)
+
+// Entry is a single audit log line describing one zone patch.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	Zone      string    `json:"zone"`
+	DryRun    bool      `json:"dryRun"`
+	Rollback  bool      `json:"rollback,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Changes   []Change  `json:"changes"`
+}
+
+// Change holds the before and after state of a single (name, type) record set.
+type Change struct {
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Before []RecordData `json:"before"`
+	After  []RecordData `json:"after"`
+}
+
+// RecordData is the audited part of a record.
+type RecordData struct {
+	Data string `json:"rdata"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+// Logger writes audit entries as JSON lines. A nil Logger discards all entries.
+type Logger struct {
+	mu       sync.Mutex
+	out      io.Writer
+	redactor *logging.Redactor
+}
+
+// New creates an audit logger from the configuration. It returns nil if no
+// audit log path is configured.
+func New(config *configuration.Configuration) (*Logger, error) {
+	if config.AuditLogPath == "" {
+		return nil, nil
+	}
+	redactor, err := logging.NewRedactor([]string{config.ApiKey}, config.LogRedactTXTPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer
+	if config.AuditLogPath == stdoutPath {
+		out = os.Stdout
+	} else {
+		file, err := newRotatingFile(config.AuditLogPath, int64(config.AuditLogMaxSizeMB)<<20, config.AuditLogMaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit log %s: %w", config.AuditLogPath, err)
+		}
+		out = file
+	}
+
+	return NewWithWriter(out, redactor), nil
+}
+
+// NewWithWriter creates an audit logger writing to out. Entries are redacted
+// with the redactor before they are written, the data of TXT records with the
+// TXT patterns of the redactor.
+func NewWithWriter(out io.Writer, redactor *logging.Redactor) *Logger {
+	return &Logger{out: out, redactor: redactor}
+}
+
+// Log writes the entry as a single JSON line.
+func (l *Logger) Log(entry Entry) {
+	if l == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	l.redact(&entry)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("unable to marshal audit entry for zone %s: %v", entry.Zone, err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		log.Errorf("unable to write audit entry for zone %s: %v", entry.Zone, err)
+	}
+}
+
+func (l *Logger) redact(entry *Entry) {
+	entry.Error = l.redactor.Redact(entry.Error)
+	for i, change := range entry.Changes {
+		redactData := l.redactor.Redact
+		if logging.IsTXT(change.Type) {
+			redactData = l.redactor.RedactTXT
+		}
+		for j := range change.Before {
+			change.Before[j].Data = redactData(change.Before[j].Data)
+		}
+		for j := range change.After {
+			change.After[j].Data = redactData(change.After[j].Data)
+		}
+		entry.Changes[i] = change
+	}
+}
+
+// Changes builds the audited changes of a zone patch, comparing the current
+// zone records against the patched record sets. The result is sorted by name
+// and type.
+func Changes(current, patch map[string]map[string][]internal.Record) []Change {
+	var changes []Change
+	for name, recordTypes := range patch {
+		for recordType, records := range recordTypes {
+			changes = append(changes, Change{
+				Name:   name,
+				Type:   recordType,
+				Before: recordData(current[name][recordType]),
+				After:  recordData(records),
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].Type < changes[j].Type
+	})
+	return changes
+}
+
+func recordData(records []internal.Record) []RecordData {
+	data := make([]RecordData, 0, len(records))
+	for _, r := range records {
+		data = append(data, RecordData{Data: r.Data, TTL: r.TTL})
+	}
+	return data
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an append-only file that is rotated once it grows beyond
+// maxSize bytes. Rotated files are kept as path.1 ... path.<maxBackups>.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	// openFile opens the file, replaced in tests.
+	openFile func(name string, flag int, perm os.FileMode) (*os.File, error)
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, openFile: os.OpenFile}
+	file, size, err := f.open(0)
+	if err != nil {
+		return nil, err
+	}
+	f.file, f.size = file, size
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first if p would grow it beyond
+// maxSize. If the rotation fails, p is still appended to the current file and
+// the rotation error is returned.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(rotateErr, err)
+}
+
+func (f *rotatingFile) open(flag int) (*os.File, int64, error) {
+	file, err := f.openFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|flag, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// rotate renames the file to path.1, shifting the older backups, or truncates
+// it if no backups are kept. The new file is opened before the current one is
+// closed, so the current file is kept if it can't be opened.
+func (f *rotatingFile) rotate() error {
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return fmt.Errorf("error rotating audit log: %w", err)
+		}
+	}
+
+	file, size, err := f.open(os.O_TRUNC)
+	if err != nil {
+		if f.maxBackups > 0 {
+			_ = os.Rename(f.path+".1", f.path)
+		}
+		return fmt.Errorf("error rotating audit log: %w", err)
+	}
+
+	current := f.file
+	f.file, f.size = file, size
+	if err := current.Close(); err != nil {
+		return fmt.Errorf("error closing rotated audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readFiles returns the content of the file and its backups by name, missing
+// files are omitted.
+func readFiles(t *testing.T, path string, names ...string) map[string]string {
+	files := make(map[string]string)
+	for _, name := range names {
+		b, err := os.ReadFile(path + name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		assert.NoError(t, err)
+		files[name] = string(b)
+	}
+	return files
+}
+
+func Test_rotatingFile(t *testing.T) {
+	testCases := []struct {
+		name       string
+		existing   string
+		maxSize    int64
+		maxBackups int
+		writes     []string
+		files      map[string]string
+	}{
+		{
+			name:       "below max size",
+			maxSize:    12,
+			maxBackups: 2,
+			writes:     []string{"line1\n", "line2\n"},
+			files:      map[string]string{"": "line1\nline2\n"},
+		},
+		{
+			name:       "max size exceeded",
+			maxSize:    10,
+			maxBackups: 2,
+			writes:     []string{"line1\n", "line2\n"},
+			files:      map[string]string{"": "line2\n", ".1": "line1\n"},
+		},
+		{
+			name:       "backups renamed",
+			maxSize:    10,
+			maxBackups: 2,
+			writes:     []string{"line1\n", "line2\n", "line3\n", "line4\n"},
+			files:      map[string]string{"": "line4\n", ".1": "line3\n", ".2": "line2\n"},
+		},
+		{
+			name:       "no backups",
+			maxSize:    10,
+			maxBackups: 0,
+			writes:     []string{"line1\n", "line2\n", "line3\n"},
+			files:      map[string]string{"": "line3\n"},
+		},
+		{
+			name:       "size of existing file",
+			existing:   "line0\n",
+			maxSize:    10,
+			maxBackups: 1,
+			writes:     []string{"line1\n"},
+			files:      map[string]string{"": "line1\n", ".1": "line0\n"},
+		},
+		{
+			name:       "entry larger than max size",
+			maxSize:    4,
+			maxBackups: 1,
+			writes:     []string{"line1\n"},
+			files:      map[string]string{"": "line1\n"},
+		},
+		{
+			name:       "no max size",
+			maxBackups: 1,
+			writes:     []string{"line1\n", "line2\n"},
+			files:      map[string]string{"": "line1\nline2\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			if tc.existing != "" {
+				assert.NoError(t, os.WriteFile(path, []byte(tc.existing), 0o600))
+			}
+
+			f, err := newRotatingFile(path, tc.maxSize, tc.maxBackups)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = f.file.Close() }()
+			for _, w := range tc.writes {
+				n, err := f.Write([]byte(w))
+				assert.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+
+			assert.Equal(t, tc.files, readFiles(t, path, "", ".1", ".2", ".3"))
+		})
+	}
+}
+
+func Test_rotatingFile_OpenError(t *testing.T) {
+	for name, maxBackups := range map[string]int{"no backups": 0, "backups": 2} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			f, err := newRotatingFile(path, 10, maxBackups)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = f.file.Close() }()
+
+			_, err = f.Write([]byte("line1\n"))
+			assert.NoError(t, err)
+
+			// the entries are still written to the current file
+			f.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+				return nil, os.ErrPermission
+			}
+			n, err := f.Write([]byte("line2\n"))
+			assert.ErrorIs(t, err, os.ErrPermission)
+			assert.Equal(t, 6, n)
+			assert.Equal(t, map[string]string{"": "line1\nline2\n"}, readFiles(t, path, "", ".1", ".2"))
+
+			// the rotation is retried with the next entry
+			f.openFile = os.OpenFile
+			_, err = f.Write([]byte("line3\n"))
+			assert.NoError(t, err)
+			files := map[string]string{"": "line3\n"}
+			if maxBackups > 0 {
+				files[".1"] = "line1\nline2\n"
+			}
+			assert.Equal(t, files, readFiles(t, path, "", ".1", ".2"))
+		})
+	}
+}
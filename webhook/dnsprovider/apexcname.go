@@ -0,0 +1,282 @@
+package dnsprovider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Modes of handling CNAME records at the zone apex, see APEX_CNAME_MODE.
+const (
+	// ApexCNAMEReject rejects CNAME records at the zone apex.
+	ApexCNAMEReject = "reject"
+	// ApexCNAMEAlias writes CNAME records at the zone apex as ALIAS records.
+	ApexCNAMEAlias = "alias"
+	// ApexCNAMEFlatten resolves the target of CNAME records at the zone apex and
+	// writes its addresses as A and AAAA records.
+	ApexCNAMEFlatten = "flatten"
+)
+
+const (
+	// aliasRecordType is the Abion record type of CNAME-like records allowed at the zone apex.
+	aliasRecordType = "ALIAS"
+	// flattenedCommentPrefix marks the comments of A and AAAA records flattened
+	// from an apex CNAME, followed by the CNAME target and its checksum, see
+	// flattenedComment.
+	flattenedCommentPrefix = "flattened from CNAME "
+	// providerSpecificComments is the provider specific property holding the
+	// comments of the records created for an endpoint.
+	providerSpecificComments = "abion/comments"
+)
+
+// ErrApexCNAME is returned for CNAME records at the zone apex if APEX_CNAME_MODE is reject.
+var ErrApexCNAME = errors.New("CNAME record not allowed at zone apex")
+
+// HostResolver resolves the target of apex CNAME records in flatten mode.
+// *net.Resolver implements it.
+type HostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// validateApexCNAMEMode checks the apex CNAME mode, an empty mode rejects apex CNAMEs.
+func validateApexCNAMEMode(mode string) error {
+	switch mode {
+	case "", ApexCNAMEReject, ApexCNAMEAlias, ApexCNAMEFlatten:
+		return nil
+	default:
+		return fmt.Errorf("invalid apex CNAME mode %q, expected %s, %s or %s", mode, ApexCNAMEReject, ApexCNAMEAlias, ApexCNAMEFlatten)
+	}
+}
+
+// isApexCNAME returns true if the endpoint is a CNAME record at the apex of the zone.
+func (p *AbionProvider) isApexCNAME(ep *endpoint.Endpoint, zoneId string) bool {
+	return ep.RecordType == endpoint.RecordTypeCNAME && p.getAbionDnsName(ep.DNSName, zoneId) == "@"
+}
+
+// translateApexCNAMEs replaces the apex CNAME endpoints of the zones according
+// to the apex CNAME mode. Endpoints to remove, i.e. deleted and old updated
+// endpoints, are translated to the records written for them before. Zones
+// that can't be translated are failed, it returns false if a zone failed in
+// fail-fast mode.
+func (p *AbionProvider) translateApexCNAMEs(ctx context.Context, endpointsByZone map[string][]*endpoint.Endpoint, remove bool, results *applyResults) bool {
+	for _, zoneId := range slices.Sorted(maps.Keys(endpointsByZone)) {
+		endpoints := endpointsByZone[zoneId]
+		if results.failed(zoneId) || !slices.ContainsFunc(endpoints, func(ep *endpoint.Endpoint) bool { return p.isApexCNAME(ep, zoneId) }) {
+			continue
+		}
+		translated, err := p.translateZoneApexCNAMEs(ctx, zoneId, endpoints, remove)
+		if err != nil {
+			if results.fail(zoneId, err) {
+				return false
+			}
+			continue
+		}
+		endpointsByZone[zoneId] = translated
+	}
+	return true
+}
+
+func (p *AbionProvider) translateZoneApexCNAMEs(ctx context.Context, zoneId string, endpoints []*endpoint.Endpoint, remove bool) ([]*endpoint.Endpoint, error) {
+	var current map[string][]internal.Record
+	translated := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if !p.isApexCNAME(ep, zoneId) {
+			translated = append(translated, ep)
+			continue
+		}
+
+		switch p.apexCNAMEMode {
+		case ApexCNAMEAlias:
+			alias := ep.DeepCopy()
+			alias.RecordType = aliasRecordType
+			translated = append(translated, alias)
+		case ApexCNAMEFlatten:
+			var flattened []*endpoint.Endpoint
+			var err error
+			if remove {
+				if current == nil {
+					current, err = p.apexRecords(ctx, zoneId)
+					if err != nil {
+						return nil, err
+					}
+				}
+				flattened = flattenedEndpoints(ep, current)
+			} else {
+				flattened, err = p.flattenApexCNAME(ctx, ep)
+				if err != nil {
+					return nil, err
+				}
+			}
+			translated = append(translated, flattened...)
+		default:
+			if remove {
+				// apex CNAMEs can't exist in reject mode, nothing to remove
+				continue
+			}
+			return nil, fmt.Errorf("%w: %s, set APEX_CNAME_MODE to alias or flatten", ErrApexCNAME, ep.DNSName)
+		}
+	}
+	return translated, nil
+}
+
+// flattenApexCNAME resolves the targets of the apex CNAME to A and AAAA endpoints.
+func (p *AbionProvider) flattenApexCNAME(ctx context.Context, ep *endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	resolver := p.hostResolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	var flattened []*endpoint.Endpoint
+	for _, target := range ep.Targets {
+		addrs, err := resolver.LookupIPAddr(ctx, target)
+		if err != nil {
+			return nil, fmt.Errorf("unable to flatten apex CNAME %s to %s: %w", ep.DNSName, target, err)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("unable to flatten apex CNAME %s: %s has no addresses", ep.DNSName, target)
+		}
+
+		a := newFlattenedEndpoint(ep, target, endpoint.RecordTypeA)
+		aaaa := newFlattenedEndpoint(ep, target, endpoint.RecordTypeAAAA)
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				a.Targets = append(a.Targets, addr.IP.String())
+			} else {
+				aaaa.Targets = append(aaaa.Targets, addr.IP.String())
+			}
+		}
+		for _, e := range []*endpoint.Endpoint{a, aaaa} {
+			if len(e.Targets) > 0 {
+				log.WithContext(ctx).Debugf("Flattening apex CNAME %s to %s %s %v", ep.DNSName, target, e.RecordType, e.Targets)
+				flattened = append(flattened, e)
+			}
+		}
+	}
+	return flattened, nil
+}
+
+func newFlattenedEndpoint(ep *endpoint.Endpoint, target string, recordType string) *endpoint.Endpoint {
+	flattened := endpoint.NewEndpointWithTTL(ep.DNSName, recordType, ep.RecordTTL)
+	flattened.Labels = ep.Labels
+	flattened.SetProviderSpecificProperty(providerSpecificComments, flattenedComment(NormalizeDnsName(target)))
+	return flattened
+}
+
+// flattenedEndpoints returns the A and AAAA endpoints of the current records
+// flattened from the apex CNAME.
+func flattenedEndpoints(ep *endpoint.Endpoint, current map[string][]internal.Record) []*endpoint.Endpoint {
+	var flattened []*endpoint.Endpoint
+	for _, target := range ep.Targets {
+		for _, recordType := range []string{endpoint.RecordTypeA, endpoint.RecordTypeAAAA} {
+			e := newFlattenedEndpoint(ep, target, recordType)
+			for _, r := range current[recordType] {
+				if flattenedTarget(r) == NormalizeDnsName(target) {
+					e.Targets = append(e.Targets, r.Data)
+				}
+			}
+			if len(e.Targets) > 0 {
+				flattened = append(flattened, e)
+			}
+		}
+	}
+	return flattened
+}
+
+// apexRecords returns the current records at the zone apex.
+func (p *AbionProvider) apexRecords(ctx context.Context, zoneId string) (map[string][]internal.Record, error) {
+	zone, err := p.Client.GetZone(ctx, zoneId)
+	if err != nil {
+		return nil, err
+	}
+	current := zone.Data.Attributes.Records["@"]
+	if current == nil {
+		current = map[string][]internal.Record{}
+	}
+	return current, nil
+}
+
+// flattenedComment returns the comment marking the records flattened from an
+// apex CNAME with the target, e.g. `flattened from CNAME lb.example.net
+// (abion:1a2b3c4d)`. The checksum of the target tells the marker apart from
+// template and manual comments starting with the same text.
+func flattenedComment(target string) string {
+	return fmt.Sprintf("%s%s (%s)", flattenedCommentPrefix, target, flattenedChecksum(target))
+}
+
+func flattenedChecksum(target string) string {
+	sum := sha256.Sum256([]byte(providerSpecificComments + " " + target))
+	return "abion:" + hex.EncodeToString(sum[:4])
+}
+
+// flattenedTarget returns the CNAME target a record was flattened from, or an
+// empty string if it was not flattened, i.e. its comment is not a marker
+// written by flattenedComment.
+func flattenedTarget(r internal.Record) string {
+	marker, ok := strings.CutPrefix(r.Comments, flattenedCommentPrefix)
+	if !ok {
+		return ""
+	}
+	target, checksum, ok := strings.Cut(marker, " (")
+	if !ok || checksum != flattenedChecksum(target)+")" {
+		return ""
+	}
+	return target
+}
+
+// apexCNAMEEndpoints returns the records at the zone apex written for apex
+// CNAMEs as CNAME endpoints, so they compare equal to the desired endpoints.
+// The remaining records are returned unchanged.
+func (p *AbionProvider) apexCNAMEEndpoints(zoneId string, records map[string][]internal.Record) ([]*endpoint.Endpoint, map[string][]internal.Record) {
+	var cnames []*endpoint.Endpoint
+	remaining := make(map[string][]internal.Record, len(records))
+
+	switch p.apexCNAMEMode {
+	case ApexCNAMEAlias:
+		for recordType, recs := range records {
+			if recordType != aliasRecordType {
+				remaining[recordType] = recs
+				continue
+			}
+			for _, r := range recs {
+				cnames = append(cnames, endpoint.NewEndpointWithTTL(p.getExternalDnsDnsName("@", zoneId), endpoint.RecordTypeCNAME, endpoint.TTL(r.TTL), asciiName(r.Data)))
+			}
+		}
+	case ApexCNAMEFlatten:
+		ttls := make(map[string]int)
+		var targets []string
+		for recordType, recs := range records {
+			if recordType != endpoint.RecordTypeA && recordType != endpoint.RecordTypeAAAA {
+				remaining[recordType] = recs
+				continue
+			}
+			for _, r := range recs {
+				target := flattenedTarget(r)
+				if target == "" {
+					remaining[recordType] = append(remaining[recordType], r)
+					continue
+				}
+				if _, ok := ttls[target]; !ok {
+					targets = append(targets, target)
+				}
+				ttls[target] = r.TTL
+			}
+		}
+		slices.Sort(targets)
+		for _, target := range targets {
+			cnames = append(cnames, endpoint.NewEndpointWithTTL(p.getExternalDnsDnsName("@", zoneId), endpoint.RecordTypeCNAME, endpoint.TTL(ttls[target]), target))
+		}
+	default:
+		return nil, records
+	}
+	return cnames, remaining
+}
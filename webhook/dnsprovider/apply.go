@@ -0,0 +1,201 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/metrics"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Modes of applying the changes of several zones, see APPLY_MODE.
+const (
+	// ApplyModeFailFast stops at the first failed zone.
+	ApplyModeFailFast = "fail-fast"
+	// ApplyModeBestEffort applies the changes of every zone independently.
+	ApplyModeBestEffort = "best-effort"
+	// ApplyModeTransactional stops at the first failed zone and rolls back the
+	// zones patched before.
+	ApplyModeTransactional = "transactional"
+)
+
+// Outcomes of the changes of a zone, see metrics.ZoneApplies.
+const (
+	zoneOutcomeApplied = "applied"
+	// zoneOutcomePartial means some changes were rejected by the pre-flight
+	// validation and the other changes were applied.
+	zoneOutcomePartial = "partial"
+	zoneOutcomeFailed  = "failed"
+	// zoneOutcomeRolledBack means the changes were applied and rolled back
+	// after another zone failed in transactional mode.
+	zoneOutcomeRolledBack = "rolled-back"
+)
+
+// validateApplyMode checks the apply mode, an empty mode is fail-fast.
+func validateApplyMode(mode string) error {
+	switch mode {
+	case "", ApplyModeFailFast, ApplyModeBestEffort, ApplyModeTransactional:
+		return nil
+	default:
+		return fmt.Errorf("invalid apply mode %q, expected %s, %s or %s", mode, ApplyModeFailFast, ApplyModeBestEffort, ApplyModeTransactional)
+	}
+}
+
+// ApplyError is returned by ApplyChanges if the changes of one or more zones
+// failed or were rejected, with the errors of every zone sorted by zone.
+type ApplyError struct {
+	Zones []*ZoneError
+}
+
+func (e *ApplyError) Error() string {
+	msgs := make([]string, 0, len(e.Zones))
+	for _, zoneErr := range e.Zones {
+		msgs = append(msgs, zoneErr.Error())
+	}
+	return fmt.Sprintf("changes of %d zone(s) failed: %s", len(e.Zones), strings.Join(msgs, "; "))
+}
+
+func (e *ApplyError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Zones))
+	for _, zoneErr := range e.Zones {
+		errs = append(errs, zoneErr)
+	}
+	return errs
+}
+
+// applyResults collects the outcome of every zone changed by an ApplyChanges call.
+type applyResults struct {
+	bestEffort    bool
+	transactional bool
+	zones         map[string]*zoneResult
+}
+
+type zoneResult struct {
+	errs       []error
+	failed     bool
+	rolledBack bool
+}
+
+func newApplyResults(mode string) *applyResults {
+	return &applyResults{
+		bestEffort:    mode == ApplyModeBestEffort,
+		transactional: mode == ApplyModeTransactional,
+		zones:         make(map[string]*zoneResult),
+	}
+}
+
+func (r *applyResults) zone(zoneId string) *zoneResult {
+	result, ok := r.zones[zoneId]
+	if !ok {
+		result = &zoneResult{}
+		r.zones[zoneId] = result
+	}
+	return result
+}
+
+// reject records changes of a zone rejected by the pre-flight validation. The
+// other changes of the zone are still applied. In transactional mode rejected
+// changes fail the zone instead, see forEachZone.
+func (r *applyResults) reject(zoneId string, err error) {
+	result := r.zone(zoneId)
+	result.errs = append(result.errs, err)
+}
+
+// fail records a failed zone, whose remaining changes are skipped. It returns
+// true if no further zones are to be processed.
+func (r *applyResults) fail(zoneId string, err error) bool {
+	result := r.zone(zoneId)
+	result.errs = append(result.errs, err)
+	result.failed = true
+	return !r.bestEffort
+}
+
+// rolledBack records a zone whose applied changes were rolled back.
+func (r *applyResults) rolledBack(zoneId string) {
+	r.zone(zoneId).rolledBack = true
+}
+
+// hasErrors returns true if any zone failed or had changes rejected.
+func (r *applyResults) hasErrors() bool {
+	for _, result := range r.zones {
+		if len(result.errs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// failed returns true if the zone failed before.
+func (r *applyResults) failed(zoneId string) bool {
+	result, ok := r.zones[zoneId]
+	return ok && result.failed
+}
+
+// forEachZone calls fn for the endpoints of every zone in a traced span. Zones
+// without endpoints or that failed before are skipped. Errors of rejected
+// endpoints only are recorded as rejections, other errors and rejections in
+// transactional mode fail the zone. It returns false if a zone failed in
+// fail-fast or transactional mode.
+func (r *applyResults) forEachZone(ctx context.Context, spanName string, endpointsByZone map[string][]*endpoint.Endpoint, fn func(ctx context.Context, zoneId string, endpoints []*endpoint.Endpoint) error) bool {
+	for _, zoneId := range slices.Sorted(maps.Keys(endpointsByZone)) {
+		if r.failed(zoneId) {
+			log.WithContext(ctx).Debugf("Skipping changes of failed zone %s", zoneId)
+			continue
+		}
+		endpoints := endpointsByZone[zoneId]
+		if len(endpoints) == 0 {
+			continue
+		}
+		r.zone(zoneId)
+		err := traceZone(ctx, spanName, zoneId, len(endpoints), func(ctx context.Context) error {
+			return fn(ctx, zoneId, endpoints)
+		})
+		if err == nil {
+			continue
+		}
+		if rejected, ok := rejections(err); ok && !r.transactional {
+			for _, e := range rejected {
+				r.reject(zoneId, e)
+			}
+			continue
+		}
+		if r.fail(zoneId, err) {
+			return false
+		}
+	}
+	return true
+}
+
+// err returns an ApplyError with the errors of every failed zone, or nil if
+// all zones were applied. The outcome of every zone is counted in the
+// metrics.ZoneApplies metric.
+func (r *applyResults) err() error {
+	var zoneErrs []*ZoneError
+	for _, zoneId := range slices.Sorted(maps.Keys(r.zones)) {
+		result := r.zones[zoneId]
+
+		outcome := zoneOutcomeApplied
+		switch {
+		case result.failed:
+			outcome = zoneOutcomeFailed
+		case result.rolledBack:
+			outcome = zoneOutcomeRolledBack
+		case len(result.errs) > 0:
+			outcome = zoneOutcomePartial
+		}
+		metrics.ZoneApplies.WithLabelValues(zoneId, outcome).Inc()
+
+		if len(result.errs) > 0 {
+			zoneErrs = append(zoneErrs, &ZoneError{Zone: zoneId, Err: errors.Join(result.errs...)})
+		}
+	}
+	if len(zoneErrs) == 0 {
+		return nil
+	}
+	return &ApplyError{Zones: zoneErrs}
+}
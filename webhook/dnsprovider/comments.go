@@ -0,0 +1,70 @@
+package dnsprovider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ErrRecordComment is returned for endpoints whose record comment template can't be rendered.
+var ErrRecordComment = errors.New("unable to render record comment")
+
+// commentData is the data of the record comment template, see
+// RECORD_COMMENT_TEMPLATE.
+type commentData struct {
+	// Owner is the external-dns owner ID of the endpoint.
+	Owner string
+	// Resource is the Kubernetes resource of the endpoint, e.g.
+	// service/default/example-service.
+	Resource   string
+	DNSName    string
+	RecordType string
+}
+
+func newCommentData(ep *endpoint.Endpoint) commentData {
+	return commentData{
+		Owner:      ep.Labels[endpoint.OwnerLabelKey],
+		Resource:   ep.Labels[endpoint.ResourceLabelKey],
+		DNSName:    ep.DNSName,
+		RecordType: ep.RecordType,
+	}
+}
+
+// newCommentTemplate parses the record comment template. It returns nil if the
+// template is empty.
+func newCommentTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("comment").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record comment template: %w", err)
+	}
+	// unknown fields are only detected when executing the template
+	if err := tmpl.Execute(&strings.Builder{}, commentData{}); err != nil {
+		return nil, fmt.Errorf("invalid record comment template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// recordComment returns the comment of the records written for the endpoint.
+// Comments set by the provider, e.g. of flattened apex CNAMEs, take precedence
+// over the comment template. Endpoints whose comment can't be rendered are
+// rejected by the pre-flight validation.
+func (p *AbionProvider) recordComment(ep *endpoint.Endpoint) (string, error) {
+	if comments, ok := ep.GetProviderSpecificProperty(providerSpecificComments); ok {
+		return comments, nil
+	}
+	if p.commentTmpl == nil {
+		return "", nil
+	}
+
+	var b strings.Builder
+	if err := p.commentTmpl.Execute(&b, newCommentData(ep)); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRecordComment, err)
+	}
+	return b.String(), nil
+}
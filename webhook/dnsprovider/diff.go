@@ -0,0 +1,216 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/metrics"
+)
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// ZoneDiff describes the record changes a patch would make to a zone.
+type ZoneDiff struct {
+	Zone    string         `json:"zone"`
+	Added   []RecordChange `json:"added"`
+	Removed []RecordChange `json:"removed"`
+	Changed []RecordChange `json:"changed"`
+}
+
+// RecordChange is a single added, removed or changed record. OldTTL is only
+// set for changed records.
+type RecordChange struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Data   string `json:"rdata"`
+	TTL    int    `json:"ttl,omitempty"`
+	OldTTL int    `json:"oldTtl,omitempty"`
+}
+
+// DiffSummary holds the number of changes of a zone diff.
+type DiffSummary struct {
+	Zone    string `json:"zone"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Changed int    `json:"changed"`
+}
+
+// computeZoneDiff compares the current zone records against the record sets of
+// a patch. Record sets not included in the patch are left untouched by the API
+// and are therefore not part of the diff. A record without TTL in the patch
+// keeps the TTL chosen by the API and is not reported as changed.
+func computeZoneDiff(zoneId string, current, patch map[string]map[string][]internal.Record) *ZoneDiff {
+	diff := &ZoneDiff{Zone: zoneId}
+
+	for name, recordTypes := range patch {
+		for recordType, after := range recordTypes {
+			before := current[name][recordType]
+
+			beforeByData := make(map[string]internal.Record, len(before))
+			for _, r := range before {
+				beforeByData[r.Data] = r
+			}
+			afterByData := make(map[string]internal.Record, len(after))
+			for _, r := range after {
+				if _, ok := afterByData[r.Data]; !ok {
+					afterByData[r.Data] = r
+				}
+			}
+
+			for data, r := range afterByData {
+				old, ok := beforeByData[data]
+				switch {
+				case !ok:
+					diff.Added = append(diff.Added, RecordChange{Name: name, Type: recordType, Data: data, TTL: r.TTL})
+				case r.TTL != 0 && r.TTL != old.TTL:
+					diff.Changed = append(diff.Changed, RecordChange{Name: name, Type: recordType, Data: data, TTL: r.TTL, OldTTL: old.TTL})
+				}
+			}
+			for data, r := range beforeByData {
+				if _, ok := afterByData[data]; !ok {
+					diff.Removed = append(diff.Removed, RecordChange{Name: name, Type: recordType, Data: data, TTL: r.TTL})
+				}
+			}
+		}
+	}
+
+	sortRecordChanges(diff.Added)
+	sortRecordChanges(diff.Removed)
+	sortRecordChanges(diff.Changed)
+	return diff
+}
+
+func sortRecordChanges(changes []RecordChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Data < b.Data
+	})
+}
+
+// Empty returns true if the diff contains no changes.
+func (d *ZoneDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Summary returns the number of changes of the diff.
+func (d *ZoneDiff) Summary() DiffSummary {
+	return DiffSummary{Zone: d.Zone, Added: len(d.Added), Removed: len(d.Removed), Changed: len(d.Changed)}
+}
+
+func (d *ZoneDiff) merge(other *ZoneDiff) {
+	d.Added = append(d.Added, other.Added...)
+	d.Removed = append(d.Removed, other.Removed...)
+	d.Changed = append(d.Changed, other.Changed...)
+	sortRecordChanges(d.Added)
+	sortRecordChanges(d.Removed)
+	sortRecordChanges(d.Changed)
+}
+
+// String returns the diff in a human-readable, unified diff like format.
+func (d *ZoneDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "zone %s: %d added, %d removed, %d changed\n", d.Zone, len(d.Added), len(d.Removed), len(d.Changed))
+	for _, c := range d.Added {
+		fmt.Fprintf(&b, "+ %s %s %s%s\n", c.Name, c.Type, c.Data, ttlString(c.TTL))
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&b, "- %s %s %s%s\n", c.Name, c.Type, c.Data, ttlString(c.TTL))
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s %s %s ttl %d -> %d\n", c.Name, c.Type, c.Data, c.OldTTL, c.TTL)
+	}
+	return b.String()
+}
+
+func ttlString(ttl int) string {
+	if ttl == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (ttl %d)", ttl)
+}
+
+// DryRunReport collects the zone diffs computed by the latest dry-run
+// ApplyChanges call.
+type DryRunReport struct {
+	mu    sync.Mutex
+	time  time.Time
+	diffs map[string]*ZoneDiff
+}
+
+func newDryRunReport() *DryRunReport {
+	return &DryRunReport{diffs: make(map[string]*ZoneDiff)}
+}
+
+func (r *DryRunReport) reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.time = time.Now().UTC()
+	r.diffs = make(map[string]*ZoneDiff)
+	metrics.DryRunChanges.Reset()
+}
+
+func (r *DryRunReport) add(diff *ZoneDiff) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	merged, ok := r.diffs[diff.Zone]
+	if !ok {
+		merged = &ZoneDiff{Zone: diff.Zone}
+		r.diffs[diff.Zone] = merged
+	}
+	merged.merge(diff)
+
+	summary := merged.Summary()
+	metrics.DryRunChanges.WithLabelValues(diff.Zone, changeAdded).Set(float64(summary.Added))
+	metrics.DryRunChanges.WithLabelValues(diff.Zone, changeRemoved).Set(float64(summary.Removed))
+	metrics.DryRunChanges.WithLabelValues(diff.Zone, changeChanged).Set(float64(summary.Changed))
+}
+
+// Diffs returns the zone diffs of the latest dry run sorted by zone.
+func (r *DryRunReport) Diffs() []*ZoneDiff {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	diffs := make([]*ZoneDiff, 0, len(r.diffs))
+	for _, d := range r.diffs {
+		diffs = append(diffs, d)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Zone < diffs[j].Zone })
+	return diffs
+}
+
+// Summaries returns the time of the latest dry run and the change counts per zone.
+func (r *DryRunReport) Summaries() (time.Time, []DiffSummary) {
+	if r == nil {
+		return time.Time{}, nil
+	}
+	diffs := r.Diffs()
+	summaries := make([]DiffSummary, 0, len(diffs))
+	for _, d := range diffs {
+		summaries = append(summaries, d.Summary())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.time, summaries
+}
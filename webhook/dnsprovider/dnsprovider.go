@@ -2,13 +2,23 @@ package dnsprovider
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"slices"
 	"strings"
+	"text/template"
 
 	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/audit"
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/metrics"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
@@ -16,87 +26,273 @@ import (
 
 type AbionProvider struct {
 	provider.BaseProvider
-	Client       internal.ApiClient
-	DryRun       bool
-	domainFilter endpoint.DomainFilter
-	zoneFilter   []string
+	Client        internal.ApiClient
+	DryRun        bool
+	domainFilter  endpoint.DomainFilter
+	zoneFilter    []string
+	auditLog      *audit.Logger
+	dryRunReport  *DryRunReport
+	zoneLocks     *zoneLocker
+	zoneCache     *zoneCache
+	zonesPageSize int
+	breaker       *internal.CircuitBreaker
+	recordTypes   recordTypeFilter
+	ttlPolicy     *ttlPolicy
+	apexCNAMEMode string
+	hostResolver  HostResolver
+	applyMode     string
+	commentTmpl   *template.Template
 }
 
 func NewAbionProvider(config *configuration.Configuration) (*AbionProvider, error) {
-	client := *internal.NewAbionClientWithTimeout(config.ApiKey, config.ApiTimeout)
+	transport, err := internal.NewTransport(internal.TransportConfig{
+		ProxyURL:            config.ApiProxyURL,
+		CAFile:              config.ApiCAFile,
+		TLSMinVersion:       config.ApiTLSMinVersion,
+		MaxIdleConnsPerHost: config.ApiMaxIdleConnsPerHost,
+		IdleConnTimeout:     config.ApiIdleConnTimeout,
+		HTTP2:               config.ApiHTTP2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client := *internal.NewAbionClientWithTransport(config.ApiKey, config.ApiTimeout, transport)
+	client.Breaker = internal.NewCircuitBreaker(config.ApiBreakerFailures, config.ApiBreakerOpenTimeout, func(state internal.BreakerState) {
+		log.Warnf("Abion API circuit breaker %s", state)
+		metrics.CircuitBreakerState.Set(float64(state))
+	})
 
 	trimmedDomains := make([]string, 0, len(config.DomainFilter))
 	externalDNSDomains := make([]string, 0, len(config.DomainFilter))
 	for _, d := range config.DomainFilter {
 		if trimmed := strings.TrimSpace(d); trimmed != "" {
-			trimmedDomains = append(trimmedDomains, trimmed)
-			if strings.HasPrefix(trimmed, "*.") {
-				externalDNSDomains = append(externalDNSDomains, trimmed[1:])
-				continue
+			trimmed, err := toASCII(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("invalid domain filter: %w", err)
 			}
-			externalDNSDomains = append(externalDNSDomains, trimmed)
+			trimmedDomains = append(trimmedDomains, trimmed)
+			externalDNSDomains = append(externalDNSDomains, domainFilterEntry(trimmed))
 		}
 	}
 
+	ttlPolicy, err := newTTLPolicy(ttlLimits{Min: config.TTLMin, Max: config.TTLMax, Default: config.TTLDefault}, config.TTLZoneOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateApexCNAMEMode(config.ApexCNAMEMode); err != nil {
+		return nil, err
+	}
+
+	if err := validateApplyMode(config.ApplyMode); err != nil {
+		return nil, err
+	}
+
+	commentTemplate, err := newCommentTemplate(config.RecordCommentTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog, err := audit.New(config)
+	if err != nil {
+		return nil, err
+	}
+
 	p := &AbionProvider{
-		Client:       &client,
-		DryRun:       config.DryRun,
-		domainFilter: endpoint.NewDomainFilter(externalDNSDomains),
-		zoneFilter:   trimmedDomains,
+		Client:        &client,
+		DryRun:        config.DryRun,
+		domainFilter:  endpoint.NewDomainFilter(externalDNSDomains),
+		zoneFilter:    trimmedDomains,
+		auditLog:      auditLog,
+		dryRunReport:  newDryRunReport(),
+		zoneLocks:     newZoneLocker(),
+		zoneCache:     newZoneCache(config.ZoneCacheTTL),
+		zonesPageSize: config.ZonesPageSize,
+		breaker:       client.Breaker,
+		recordTypes:   newRecordTypeFilter(config.ManagedRecordTypes),
+		ttlPolicy:     ttlPolicy,
+		apexCNAMEMode: config.ApexCNAMEMode,
+		hostResolver:  net.DefaultResolver,
+		applyMode:     config.ApplyMode,
+		commentTmpl:   commentTemplate,
 	}
 
 	return p, nil
 }
 
+// AdjustEndpoints converts the DNS names and CNAME targets of internationalized
+// domain names to A-labels and applies the TTL policy, so the endpoints compare
+// equal to the records read from the Abion API. Invalid names are rejected by
+// ApplyChanges.
+func (p *AbionProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	return p.AdjustEndpointsContext(context.Background(), endpoints)
+}
+
+// AdjustEndpointsContext is AdjustEndpoints with the context of the request,
+// which is added to the logs.
+func (p *AbionProvider) AdjustEndpointsContext(ctx context.Context, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	endpoints = toASCIIEndpoints(ctx, endpoints)
+	p.ttlPolicy.applyAll(ctx, endpoints)
+	return endpoints
+}
+
 func (p *AbionProvider) GetDomainFilter() endpoint.DomainFilter {
 	return p.domainFilter
 }
 
+// Ready returns internal.ErrCircuitOpen while the Abion API circuit breaker is
+// open, and nil otherwise.
+func (p *AbionProvider) Ready() error {
+	if p.breaker.State() == internal.BreakerOpen {
+		return internal.ErrCircuitOpen
+	}
+	return nil
+}
+
+// FlushCache clears the cached zones and the latest dry-run report, so the next
+// sync re-reads the zones from the Abion API.
+func (p *AbionProvider) FlushCache() {
+	p.zoneCache.flush()
+	p.dryRunReport.reset()
+}
+
+// DryRunReport returns the zone diffs computed by the latest dry-run ApplyChanges.
+func (p *AbionProvider) DryRunReport() *DryRunReport {
+	return p.dryRunReport
+}
+
 // Records returns the list of records for zones matching the domain filter.
 // If no domain filter is configured, all accessible zones are returned.
 func (p *AbionProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	ctx, span := tracer.Start(ctx, "AbionProvider.Records")
+	endpoints, err := p.records(ctx)
+	span.SetAttributes(attribute.Int(attributeEndpoints, len(endpoints)))
+	endSpan(span, err)
+	return endpoints, err
+}
+
+func (p *AbionProvider) records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	var endpoints []*endpoint.Endpoint
 
 	zoneIDs, err := p.getFilteredZoneIDs(ctx)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int(attributeZones, len(zoneIDs)))
 
+	resolver := newZoneResolver(zoneIDs)
 	for _, zoneID := range zoneIDs {
-		zone, err := p.Client.GetZone(ctx, zoneID)
+		zoneEndpoints, err := p.ZoneRecords(ctx, zoneID)
 		if err != nil {
-			return nil, err
+			return nil, classifyError(&ZoneError{Zone: zoneID, Err: err})
 		}
-
-		for dnsName, record := range zone.Data.Attributes.Records {
-			for recordType, recordDetails := range record {
-				for _, recordDetail := range recordDetails {
-					ep := endpoint.NewEndpointWithTTL(p.getExternalDnsDnsName(dnsName, zoneID), recordType, endpoint.TTL(recordDetail.TTL), recordDetail.Data)
-					endpoints = append(endpoints, ep)
-				}
+		for _, ep := range p.recordTypes.filter(zoneEndpoints) {
+			// records below a delegated subzone belong to the subzone, e.g. the NS
+			// records of dev.example.com in example.com
+			if resolved, _, _ := resolver.Resolve(ep.DNSName); resolved != zoneID {
+				log.WithContext(ctx).Debugf("Skipping record %s %s of zone %s because it belongs to zone %s", displayName(ep.DNSName), ep.RecordType, displayName(zoneID), displayName(resolved))
+				continue
 			}
+			endpoints = append(endpoints, ep)
 		}
 	}
 
-	log.WithFields(log.Fields{
-		"endpoints": endpoints,
+	log.WithContext(ctx).WithFields(log.Fields{
+		"endpoints": redactEndpoints(endpoints),
 	}).Debug("Records")
 
 	return endpoints, nil
 }
 
+// ZoneRecords returns the records of a single zone as external-dns endpoints.
+func (p *AbionProvider) ZoneRecords(ctx context.Context, zoneID string) ([]*endpoint.Endpoint, error) {
+	zone, err := p.Client.GetZone(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []*endpoint.Endpoint
+	for dnsName, record := range zone.Data.Attributes.Records {
+		if dnsName == "@" {
+			var cnames []*endpoint.Endpoint
+			cnames, record = p.apexCNAMEEndpoints(zoneID, record)
+			endpoints = append(endpoints, cnames...)
+		}
+		for recordType, recordDetails := range record {
+			for _, recordDetail := range recordDetails {
+				data := recordDetail.Data
+				if recordType == endpoint.RecordTypeCNAME {
+					data = asciiName(data)
+				}
+				ep := endpoint.NewEndpointWithTTL(p.getExternalDnsDnsName(dnsName, zoneID), recordType, endpoint.TTL(recordDetail.TTL), data)
+				endpoints = append(endpoints, ep)
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// Zones returns the zones matching the domain filter, including their settings
+// and flags.
+func (p *AbionProvider) Zones(ctx context.Context) ([]internal.Zone, error) {
+	zoneIDs, err := p.getFilteredZoneIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make([]internal.Zone, 0, len(zoneIDs))
+	for _, zoneID := range zoneIDs {
+		zone, err := p.Client.GetZone(ctx, zoneID)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, *zone.Data)
+	}
+	return zones, nil
+}
+
+// ReplaceRecordSets replaces the given (name, type) record sets of a zone. Record
+// sets not included are left untouched. In dry-run mode only the diff is reported.
+func (p *AbionProvider) ReplaceRecordSets(ctx context.Context, zoneID string, records map[string]map[string][]internal.Record) error {
+	unlock := p.zoneLocks.lock(zoneID)
+	defer unlock()
+
+	zone, err := p.Client.GetZone(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+
+	if p.DryRun {
+		p.dryRunReport.reset()
+	}
+	return p.submitPatchZone(ctx, zoneID, zone.Data.Attributes.Records, records)
+}
+
 // getFilteredZoneIDs returns zone IDs to process. If a domain filter is configured,
 // it returns only those zones directly (skipping the expensive GetZones listing)
 // unless the filter contains wildcard patterns, in which case all zones are fetched
 // and matched against the patterns. Otherwise, it falls back to listing all zones.
 func (p *AbionProvider) getFilteredZoneIDs(ctx context.Context) ([]string, error) {
+	if zoneIDs, ok := p.zoneCache.get(); ok {
+		return zoneIDs, nil
+	}
+
+	zoneIDs, err := p.listFilteredZoneIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.zoneCache.set(zoneIDs)
+	return zoneIDs, nil
+}
+
+func (p *AbionProvider) listFilteredZoneIDs(ctx context.Context) ([]string, error) {
 	if len(p.zoneFilter) > 0 {
 		if !p.hasWildcardFilter() {
-			log.Debugf("Using domain filter, fetching only zones: %v", p.zoneFilter)
+			log.WithContext(ctx).Debugf("Using domain filter, fetching only zones: %v", p.zoneFilter)
 			return p.zoneFilter, nil
 		}
 
-		log.Debugf("Wildcard detected in domain filter, fetching all zones and matching against: %v", p.zoneFilter)
+		log.WithContext(ctx).Debugf("Wildcard detected in domain filter, fetching all zones and matching against: %v", p.zoneFilter)
 		allZones, err := p.fetchAllZoneIDs(ctx)
 		if err != nil {
 			return nil, err
@@ -108,7 +304,7 @@ func (p *AbionProvider) getFilteredZoneIDs(ctx context.Context) ([]string, error
 				matched = append(matched, zone)
 			}
 		}
-		log.Debugf("Wildcard filter matched zones: %v", matched)
+		log.WithContext(ctx).Debugf("Wildcard filter matched zones: %v", matched)
 		return matched, nil
 	}
 
@@ -117,25 +313,16 @@ func (p *AbionProvider) getFilteredZoneIDs(ctx context.Context) ([]string, error
 
 func (p *AbionProvider) fetchAllZoneIDs(ctx context.Context) ([]string, error) {
 	var zoneIDs []string
-	offset := 0
-	for {
-		page := &internal.Pagination{
-			Offset: offset,
-		}
-
-		zonesResponse, err := p.Client.GetZones(ctx, page)
+	for zone, err := range internal.ZonesIter(ctx, p.Client, p.zonesPageSize) {
 		if err != nil {
 			return nil, err
 		}
-
-		for _, zoneData := range zonesResponse.Data {
-			zoneIDs = append(zoneIDs, zoneData.ID)
-		}
-
-		offset = page.Offset + len(zonesResponse.Data)
-		if offset >= zonesResponse.Meta.Total {
-			break
+		zoneID, err := toASCII(zone.ID)
+		if err != nil {
+			log.WithContext(ctx).Warnf("Keeping zone ID as returned by the API: %v", err)
+			zoneID = zone.ID
 		}
+		zoneIDs = append(zoneIDs, zoneID)
 	}
 
 	return zoneIDs, nil
@@ -144,7 +331,7 @@ func (p *AbionProvider) fetchAllZoneIDs(ctx context.Context) ([]string, error) {
 // hasWildcardFilter returns true if any entry in the zone filter contains a wildcard.
 func (p *AbionProvider) hasWildcardFilter() bool {
 	for _, f := range p.zoneFilter {
-		if strings.Contains(f, "*") {
+		if strings.Contains(f, wildcardLabel) {
 			return true
 		}
 	}
@@ -156,31 +343,20 @@ func (p *AbionProvider) hasWildcardFilter() bool {
 // subdomain of example.com (e.g. sub.example.com, deep.sub.example.com).
 func (p *AbionProvider) matchesZoneFilter(zone string) bool {
 	for _, filter := range p.zoneFilter {
-		if !strings.Contains(filter, "*") {
-			if zone == filter {
-				return true
-			}
-			continue
-		}
-
-		// *.example.com → match zones ending in .example.com
-		if strings.HasPrefix(filter, "*.") {
-			suffix := filter[1:] // ".example.com"
-			if strings.HasSuffix(zone, suffix) {
-				return true
-			}
+		if matchesZoneFilterEntry(filter, zone) {
+			return true
 		}
 	}
 	return false
 }
 
-func (p *AbionProvider) endpointsByZone(zoneNameIDMapper provider.ZoneIDName, endpoints []*endpoint.Endpoint) map[string][]*endpoint.Endpoint {
+func (p *AbionProvider) endpointsByZone(ctx context.Context, resolver *zoneResolver, endpoints []*endpoint.Endpoint) map[string][]*endpoint.Endpoint {
 	endpointsByZone := make(map[string][]*endpoint.Endpoint)
 
 	for _, ep := range endpoints {
-		zoneID, _ := zoneNameIDMapper.FindZone(ep.DNSName)
-		if zoneID == "" {
-			log.Debugf("Skipping record %s because no hosted zone matching record DNS Name was detected", ep.DNSName)
+		zoneID, _, ok := resolver.Resolve(ep.DNSName)
+		if !ok {
+			log.WithContext(ctx).Debugf("Skipping record %s because no hosted zone matching record DNS Name was detected", displayName(ep.DNSName))
 			continue
 		}
 		endpointsByZone[zoneID] = append(endpointsByZone[zoneID], ep)
@@ -190,247 +366,334 @@ func (p *AbionProvider) endpointsByZone(zoneNameIDMapper provider.ZoneIDName, en
 }
 
 // ApplyChanges applies a given set of changes for zones
+// Transient errors are returned as soft errors, see SoftError.
 func (p *AbionProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
-	zoneNameIDMapper, err := p.populateZoneIdMapper(ctx)
-	if err != nil {
+	ctx, span := tracer.Start(ctx, "AbionProvider.ApplyChanges", trace.WithAttributes(
+		attribute.Int("abion.changes.create", len(changes.Create)),
+		attribute.Int("abion.changes.update", len(changes.UpdateNew)),
+		attribute.Int("abion.changes.delete", len(changes.Delete)),
+	))
+	err := classifyError(p.applyChanges(ctx, changes))
+	endSpan(span, err)
+	return err
+}
+
+func (p *AbionProvider) applyChanges(ctx context.Context, changes *plan.Changes) error {
+	if p.DryRun {
+		p.dryRunReport.reset()
+	}
+
+	if err := p.recordTypes.check(changes); err != nil {
+		return err
+	}
+	if err := checkDnsNames(slices.Concat(changes.Create, changes.UpdateNew)); err != nil {
 		return err
 	}
 
-	createsByDomain := p.endpointsByZone(zoneNameIDMapper, changes.Create)
-	updatesByDomainNew := p.endpointsByZone(zoneNameIDMapper, changes.UpdateNew)
-	updatesByDomainOld := p.endpointsByZone(zoneNameIDMapper, changes.UpdateOld)
-	deletesByDomain := p.endpointsByZone(zoneNameIDMapper, changes.Delete)
+	p.ttlPolicy.applyAll(ctx, changes.Create)
+	p.ttlPolicy.applyAll(ctx, changes.UpdateNew)
 
-	if err := p.processCreateActions(ctx, createsByDomain); err != nil {
+	resolver, err := p.populateZoneResolver(ctx)
+	if err != nil {
 		return err
 	}
 
-	if err := p.processUpdateActions(ctx, updatesByDomainNew, updatesByDomainOld); err != nil {
-		return err
+	createsByDomain := p.endpointsByZone(ctx, resolver, changes.Create)
+	updatesByDomainNew := p.endpointsByZone(ctx, resolver, changes.UpdateNew)
+	updatesByDomainOld := p.endpointsByZone(ctx, resolver, changes.UpdateOld)
+	deletesByDomain := p.endpointsByZone(ctx, resolver, changes.Delete)
+
+	// the zones are locked for the whole call including the rollback, so the
+	// phases of concurrent calls changing the same zone don't interleave
+	zoneIds := slices.Concat(slices.Collect(maps.Keys(createsByDomain)), slices.Collect(maps.Keys(updatesByDomainNew)),
+		slices.Collect(maps.Keys(updatesByDomainOld)), slices.Collect(maps.Keys(deletesByDomain)))
+	unlock := p.zoneLocks.lock(zoneIds...)
+	defer unlock()
+
+	results := newApplyResults(p.applyMode)
+	var journal *patchJournal
+	if p.applyMode == ApplyModeTransactional {
+		journal = newPatchJournal()
+		ctx = withPatchJournal(ctx, journal)
+	}
+	if !p.translateAndProcess(ctx, results, createsByDomain, updatesByDomainNew, updatesByDomainOld, deletesByDomain) {
+		log.WithContext(ctx).Warn("Stopped applying changes at the first failed zone")
+	}
+	// in transactional mode every failed or rejected change rolls back the
+	// applied changes
+	if journal != nil && results.hasErrors() {
+		p.rollback(ctx, journal, results)
 	}
+	return results.err()
+}
 
-	if err := p.processDeleteActions(ctx, deletesByDomain); err != nil {
-		return err
+// translateAndProcess translates the apex CNAMEs, validates and applies the
+// changes of every zone. It returns false if it stopped at a failed zone in
+// fail-fast mode.
+func (p *AbionProvider) translateAndProcess(ctx context.Context, results *applyResults, createsByDomain, updatesByDomainNew, updatesByDomainOld, deletesByDomain map[string][]*endpoint.Endpoint) bool {
+	for _, translate := range []struct {
+		endpointsByZone map[string][]*endpoint.Endpoint
+		remove          bool
+	}{
+		{createsByDomain, false},
+		{updatesByDomainNew, false},
+		{updatesByDomainOld, true},
+		{deletesByDomain, true},
+	} {
+		if !p.translateApexCNAMEs(ctx, translate.endpointsByZone, translate.remove, results) {
+			return false
+		}
 	}
-	return nil
+
+	// the created and updated endpoints are validated against the records
+	// remaining after the updates and deletes, see preflight
+	removedByDomain := make(map[string][]*endpoint.Endpoint)
+	for zoneId, endpoints := range updatesByDomainOld {
+		removedByDomain[zoneId] = append(removedByDomain[zoneId], endpoints...)
+	}
+	for zoneId, endpoints := range deletesByDomain {
+		removedByDomain[zoneId] = append(removedByDomain[zoneId], endpoints...)
+	}
+
+	return p.processCreateActions(ctx, createsByDomain, updatesByDomainNew, removedByDomain, results) &&
+		p.processUpdateActions(ctx, updatesByDomainNew, updatesByDomainOld, removedByDomain, results) &&
+		p.processDeleteActions(ctx, deletesByDomain, results)
 }
 
-func (p *AbionProvider) populateZoneIdMapper(ctx context.Context) (provider.ZoneIDName, error) {
+func (p *AbionProvider) populateZoneResolver(ctx context.Context) (*zoneResolver, error) {
 	zoneIDs, err := p.getFilteredZoneIDs(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return newZoneResolver(zoneIDs), nil
+}
 
-	zoneNameIDMapper := provider.ZoneIDName{}
-	for _, zoneId := range zoneIDs {
-		zoneNameIDMapper.Add(zoneId, zoneId)
-	}
-	return zoneNameIDMapper, nil
+func (p *AbionProvider) processCreateActions(ctx context.Context, createsByDomain, updatesByDomainNew, removedByDomain map[string][]*endpoint.Endpoint, results *applyResults) bool {
+	return results.forEachZone(ctx, "AbionProvider.processCreateActions", createsByDomain, func(ctx context.Context, zoneId string, createEndpoints []*endpoint.Endpoint) error {
+		return p.processZoneCreateActions(ctx, zoneId, createEndpoints, updatesByDomainNew[zoneId], removedByDomain[zoneId])
+	})
 }
 
-func (p *AbionProvider) processCreateActions(ctx context.Context, createsByDomain map[string][]*endpoint.Endpoint) error {
-	for zoneId, createEndpoints := range createsByDomain {
+// processZoneCreateActions creates the endpoints of a single zone, the zone lock is held by
+// applyChanges. The endpoints are validated against the zone records first, the updated endpoints of the
+// zone are validated with them but only rejected when they are updated, see preflight.
+func (p *AbionProvider) processZoneCreateActions(ctx context.Context, zoneId string, createEndpoints, updateEndpointsNew, removedEndpoints []*endpoint.Endpoint) error {
+	zone, err := p.Client.GetZone(ctx, zoneId)
+	if err != nil {
+		return err
+	}
 
-		zone, err := p.Client.GetZone(ctx, zoneId)
-		if err != nil {
-			return err
-		}
+	createEndpoints, rejected := p.preflight(ctx, zoneId, zone.Data.Attributes.Records, createEndpoints, updateEndpointsNew, removedEndpoints)
+	if len(createEndpoints) == 0 {
+		return errors.Join(rejected...)
+	}
 
-		records := make(map[string]map[string][]internal.Record)
+	records := make(map[string]map[string][]internal.Record)
 
-		for _, createEndpoint := range createEndpoints {
+	for _, createEndpoint := range createEndpoints {
 
-			dnsName := p.getAbionDnsName(createEndpoint.DNSName, zoneId)
+		dnsName := p.getAbionDnsName(createEndpoint.DNSName, zoneId)
 
-			var data []internal.Record
-			for _, target := range createEndpoint.Targets {
-				target = p.formatTarget(createEndpoint, target)
+		var data []internal.Record
+		for _, target := range createEndpoint.Targets {
+			target = p.formatTarget(createEndpoint, target)
 
-				var record internal.Record
-				record = p.createRecord(createEndpoint, record, target)
-				data = append(data, record)
-			}
+			var record internal.Record
+			record = p.createRecord(createEndpoint, record, target)
+			data = append(data, record)
+		}
 
-			if records[dnsName] == nil {
-				records[dnsName] = make(map[string][]internal.Record)
-			}
+		if records[dnsName] == nil {
+			records[dnsName] = make(map[string][]internal.Record)
+		}
 
-			// add all existing records to make sure to not clear the other zone records on same name level and of same record type
-			log.WithFields(
+		// add all existing records to make sure to not clear the other zone records on same name level and of same record type
+		log.WithContext(ctx).WithFields(
+			log.Fields{
+				"dnsName": dnsName,
+			}).Debug("Checking existing zone records on name level")
+		existingRecordsByDNSName, ok := zone.Data.Attributes.Records[dnsName]
+		if ok {
+			log.WithContext(ctx).WithFields(
 				log.Fields{
-					"dnsName": dnsName,
-				}).Debug("Checking existing zone records on name level")
-			existingRecordsByDNSName, ok := zone.Data.Attributes.Records[dnsName]
+					"dnsName":    dnsName,
+					"recordType": createEndpoint.RecordType,
+				}).Debug("Checking existing zone records of same record type on same dns name level")
+			existingRecordsOfSameRecordType, ok := existingRecordsByDNSName[createEndpoint.RecordType]
 			if ok {
-				log.WithFields(
-					log.Fields{
-						"dnsName":    dnsName,
-						"recordType": createEndpoint.RecordType,
-					}).Debug("Checking existing zone records of same record type on same dns name level")
-				existingRecordsOfSameRecordType, ok := existingRecordsByDNSName[createEndpoint.RecordType]
-				if ok {
-					data = append(data, existingRecordsOfSameRecordType...)
-				}
+				data = append(data, existingRecordsOfSameRecordType...)
 			}
-
-			records[dnsName][createEndpoint.RecordType] = data
-		}
-
-		log.WithFields(log.Fields{
-			"records": records,
-		}).Debug("Create records")
-
-		if p.DryRun {
-			continue
 		}
 
-		err = p.submitPatchZone(ctx, zoneId, records)
-		if err != nil {
-			return err
-		}
+		records[dnsName][createEndpoint.RecordType] = data
 	}
-	return nil
-}
 
-func (p *AbionProvider) processUpdateActions(ctx context.Context, updatesByDomainNew map[string][]*endpoint.Endpoint, updatesByDomainOld map[string][]*endpoint.Endpoint) error {
-	for zoneId, updateEndpointsNew := range updatesByDomainNew {
+	log.WithContext(ctx).WithFields(log.Fields{
+		"records": logging.RedactRecords(records),
+	}).Debug("Create records")
 
-		currentZone, err := p.Client.GetZone(ctx, zoneId)
-		if err != nil {
-			log.Warnf("unable to get zone: %s, error: %v", zoneId, err)
-			continue
-		}
+	return errors.Join(slices.Concat(rejected, []error{p.submitPatchZone(ctx, zoneId, zone.Data.Attributes.Records, records)})...)
+}
 
-		records := make(map[string]map[string][]internal.Record)
+func (p *AbionProvider) processUpdateActions(ctx context.Context, updatesByDomainNew, updatesByDomainOld, removedByDomain map[string][]*endpoint.Endpoint, results *applyResults) bool {
+	return results.forEachZone(ctx, "AbionProvider.processUpdateActions", updatesByDomainNew, func(ctx context.Context, zoneId string, updateEndpointsNew []*endpoint.Endpoint) error {
+		return p.processZoneUpdateActions(ctx, zoneId, updateEndpointsNew, updatesByDomainOld, removedByDomain[zoneId])
+	})
+}
 
-		for _, updateEndpointNew := range updateEndpointsNew {
+// processZoneUpdateActions updates the endpoints of a single zone, the zone lock is held by
+// applyChanges. The endpoints are validated against the zone records first, see preflight.
+func (p *AbionProvider) processZoneUpdateActions(ctx context.Context, zoneId string, updateEndpointsNew []*endpoint.Endpoint, updatesByDomainOld map[string][]*endpoint.Endpoint, removedEndpoints []*endpoint.Endpoint) error {
+	currentZone, err := p.Client.GetZone(ctx, zoneId)
+	if err != nil {
+		return err
+	}
 
-			dnsName := p.getAbionDnsName(updateEndpointNew.DNSName, zoneId)
+	updateEndpointsNew, rejected := p.preflight(ctx, zoneId, currentZone.Data.Attributes.Records, updateEndpointsNew, nil, removedEndpoints)
+	if len(updateEndpointsNew) == 0 {
+		return errors.Join(rejected...)
+	}
 
-			var data []internal.Record
-			currentSubDomain, subdomainExist := currentZone.Data.Attributes.Records[dnsName] // subdomain www or @ if root
-			if subdomainExist {
-				currentRecords, recordsExist := currentSubDomain[updateEndpointNew.RecordType] // current records of type TXT, A, etc., on same dns name/subdomain (@, www, etc)
-				if recordsExist {
-					for _, target := range updateEndpointNew.Targets {
-						// always add the updated (new) changes from external-dns
-						target = p.formatTarget(updateEndpointNew, target)
-						log.WithFields(
-							log.Fields{
-								"recordType": updateEndpointNew.RecordType,
-								"target":     target,
-							}).Debug("Adding updated (new) zone record")
-						var record internal.Record
-						record = p.createRecord(updateEndpointNew, record, target)
-						data = append(data, record)
-					}
-					for _, currentRecord := range currentRecords {
-						// need to add all the current records which are not included in update (old) changes
-						addRecord := true
-						for _, updateEndpointsOld := range updatesByDomainOld {
-							for _, updateEndpointOld := range updateEndpointsOld {
-								if updateEndpointOld.RecordType == updateEndpointNew.RecordType { // make sure compare same record type
-									for _, oldTarget := range updateEndpointOld.Targets {
-										oldTarget = p.formatTarget(updateEndpointOld, oldTarget)
-										if currentRecord.Data == oldTarget { // if any old target matches with current record data, it means it has already been added by the updated (new) changes from external-dns.
-											log.WithFields(
-												log.Fields{
-													"currentRecord": currentRecord,
-												}).Debug("Don't add this record as an updated version has already been added by the updated (new) changes from external-dns")
-											addRecord = false
-										}
+	records := make(map[string]map[string][]internal.Record)
+
+	for _, updateEndpointNew := range updateEndpointsNew {
+
+		dnsName := p.getAbionDnsName(updateEndpointNew.DNSName, zoneId)
+
+		var data []internal.Record
+		currentSubDomain, subdomainExist := currentZone.Data.Attributes.Records[dnsName] // subdomain www or @ if root
+		if subdomainExist {
+			currentRecords, recordsExist := currentSubDomain[updateEndpointNew.RecordType] // current records of type TXT, A, etc., on same dns name/subdomain (@, www, etc)
+			if recordsExist {
+				for _, target := range updateEndpointNew.Targets {
+					// always add the updated (new) changes from external-dns
+					target = p.formatTarget(updateEndpointNew, target)
+					log.WithContext(ctx).WithFields(
+						log.Fields{
+							"recordType": updateEndpointNew.RecordType,
+							"target":     redactTarget(updateEndpointNew.RecordType, target),
+						}).Debug("Adding updated (new) zone record")
+					var record internal.Record
+					record = p.createRecord(updateEndpointNew, record, target)
+					data = append(data, record)
+				}
+				for _, currentRecord := range currentRecords {
+					// need to add all the current records which are not included in update (old) changes
+					addRecord := true
+					for _, updateEndpointsOld := range updatesByDomainOld {
+						for _, updateEndpointOld := range updateEndpointsOld {
+							if updateEndpointOld.RecordType == updateEndpointNew.RecordType { // make sure compare same record type
+								for _, oldTarget := range updateEndpointOld.Targets {
+									oldTarget = p.formatTarget(updateEndpointOld, oldTarget)
+									if currentRecord.Data == oldTarget { // if any old target matches with current record data, it means it has already been added by the updated (new) changes from external-dns.
+										log.WithContext(ctx).WithFields(
+											log.Fields{
+												"currentRecord": redactRecord(updateEndpointNew.RecordType, currentRecord),
+											}).Debug("Don't add this record as an updated version has already been added by the updated (new) changes from external-dns")
+										addRecord = false
 									}
 								}
 							}
 						}
-						if addRecord {
-							log.WithFields(
-								log.Fields{
-									"currentRecord": currentRecord,
-								}).Debug("Adding current zone record")
-							data = append(data, currentRecord)
-						}
+					}
+					if addRecord {
+						log.WithContext(ctx).WithFields(
+							log.Fields{
+								"currentRecord": redactRecord(updateEndpointNew.RecordType, currentRecord),
+							}).Debug("Adding current zone record")
+						data = append(data, currentRecord)
 					}
 				}
 			}
-
-			if records[dnsName] == nil {
-				records[dnsName] = make(map[string][]internal.Record)
-			}
-			records[dnsName][updateEndpointNew.RecordType] = data
 		}
 
-		log.WithFields(log.Fields{
-			"records": records,
-		}).Debug("Update records")
-
-		if p.DryRun {
-			continue
-		}
-
-		err = p.submitPatchZone(ctx, zoneId, records)
-		if err != nil {
-			return err
+		if records[dnsName] == nil {
+			records[dnsName] = make(map[string][]internal.Record)
 		}
+		records[dnsName][updateEndpointNew.RecordType] = data
 	}
-	return nil
-}
 
-func (p *AbionProvider) processDeleteActions(ctx context.Context, deletesByDomain map[string][]*endpoint.Endpoint) error {
-	for zoneId, deleteEndpoints := range deletesByDomain {
+	log.WithContext(ctx).WithFields(log.Fields{
+		"records": logging.RedactRecords(records),
+	}).Debug("Update records")
 
-		currentZone, err := p.Client.GetZone(ctx, zoneId)
-		if err != nil {
-			log.Warnf("unable to get zone: %s, error: %v", zoneId, err)
-			continue
-		}
+	return errors.Join(slices.Concat(rejected, []error{p.submitPatchZone(ctx, zoneId, currentZone.Data.Attributes.Records, records)})...)
+}
+
+func (p *AbionProvider) processDeleteActions(ctx context.Context, deletesByDomain map[string][]*endpoint.Endpoint, results *applyResults) bool {
+	return results.forEachZone(ctx, "AbionProvider.processDeleteActions", deletesByDomain, p.processZoneDeleteActions)
+}
 
-		records := make(map[string]map[string][]internal.Record)
+// processZoneDeleteActions deletes the endpoints of a single zone, the zone lock is held by
+// applyChanges.
+func (p *AbionProvider) processZoneDeleteActions(ctx context.Context, zoneId string, deleteEndpoints []*endpoint.Endpoint) error {
+	currentZone, err := p.Client.GetZone(ctx, zoneId)
+	if err != nil {
+		return err
+	}
 
-		for _, deleteEndpoint := range deleteEndpoints {
+	records := make(map[string]map[string][]internal.Record)
 
-			dnsName := p.getAbionDnsName(deleteEndpoint.DNSName, zoneId)
+	for _, deleteEndpoint := range deleteEndpoints {
 
-			var data []internal.Record
-			currentSubDomain, subDomainExist := currentZone.Data.Attributes.Records[dnsName] // subdomain www or @ if root
-			if subDomainExist {
-				existingRecordsForRecordType, recordsExist := currentSubDomain[deleteEndpoint.RecordType]
-				if recordsExist {
-					var targets []string
-					for _, target := range deleteEndpoint.Targets {
-						target = p.formatTarget(deleteEndpoint, target)
-						targets = append(targets, target)
-					}
+		dnsName := p.getAbionDnsName(deleteEndpoint.DNSName, zoneId)
 
-					remainingRecords := slices.DeleteFunc(existingRecordsForRecordType, func(r internal.Record) bool {
-						return slices.Contains(targets, r.Data)
-					})
-					data = remainingRecords
+		var data []internal.Record
+		currentSubDomain, subDomainExist := currentZone.Data.Attributes.Records[dnsName] // subdomain www or @ if root
+		if subDomainExist {
+			existingRecordsForRecordType, recordsExist := currentSubDomain[deleteEndpoint.RecordType]
+			if recordsExist {
+				var targets []string
+				for _, target := range deleteEndpoint.Targets {
+					target = p.formatTarget(deleteEndpoint, target)
+					targets = append(targets, target)
 				}
-			}
 
-			if records[dnsName] == nil {
-				records[dnsName] = make(map[string][]internal.Record)
+				// delete from a copy, the current records are needed unchanged to submit the patch
+				remainingRecords := slices.DeleteFunc(slices.Clone(existingRecordsForRecordType), func(r internal.Record) bool {
+					return slices.Contains(targets, r.Data)
+				})
+				data = remainingRecords
 			}
-			records[dnsName][deleteEndpoint.RecordType] = data
-		}
-		log.WithFields(log.Fields{
-			"records": records,
-		}).Debug("Delete records")
-
-		if p.DryRun {
-			continue
 		}
 
-		err = p.submitPatchZone(ctx, zoneId, records)
-		if err != nil {
-			return err
+		if records[dnsName] == nil {
+			records[dnsName] = make(map[string][]internal.Record)
 		}
+		records[dnsName][deleteEndpoint.RecordType] = data
 	}
-	return nil
+	log.WithContext(ctx).WithFields(log.Fields{
+		"records": logging.RedactRecords(records),
+	}).Debug("Delete records")
+
+	return p.submitPatchZone(ctx, zoneId, currentZone.Data.Attributes.Records, records)
 }
 
-func (p *AbionProvider) submitPatchZone(ctx context.Context, zoneId string, records map[string]map[string][]internal.Record) error {
+// submitPatchZone patches the zone with the given record sets and writes an
+// audit entry describing the change. In dry-run mode the patch is not submitted,
+// instead the diff against the current records is logged and reported.
+func (p *AbionProvider) submitPatchZone(ctx context.Context, zoneId string, current map[string]map[string][]internal.Record, records map[string]map[string][]internal.Record) error {
+	entry := audit.Entry{
+		RequestID: internal.RequestIDFromContext(ctx),
+		Zone:      zoneId,
+		DryRun:    p.DryRun,
+		Changes:   audit.Changes(current, records),
+	}
+
+	if p.DryRun {
+		entry.Outcome = audit.OutcomeDryRun
+		p.auditLog.Log(entry)
+		p.logDryRunDiff(ctx, computeZoneDiff(zoneId, current, records))
+		return nil
+	}
+
+	if err := p.checkZoneUnmodified(ctx, zoneId, current, records); err != nil {
+		entry.Outcome = audit.OutcomeFailed
+		entry.Error = err.Error()
+		p.auditLog.Log(entry)
+		return err
+	}
+
 	patchRequest := internal.ZoneRequest{
 		Data: internal.Zone{
 			Type: "zone",
@@ -441,17 +704,110 @@ func (p *AbionProvider) submitPatchZone(ctx context.Context, zoneId string, reco
 		},
 	}
 
-	_, err := p.Client.PatchZone(ctx, zoneId, patchRequest)
+	resp, err := p.Client.PatchZone(ctx, zoneId, patchRequest)
 	if err != nil {
+		entry.Outcome = audit.OutcomeFailed
+		entry.Error = err.Error()
+		p.auditLog.Log(entry)
 		return fmt.Errorf("error updating zone %w", err)
 	}
 
+	patchJournalFromContext(ctx).record(zoneId, current, appliedRecordSets(records, resp))
+	entry.Outcome = audit.OutcomeApplied
+	p.auditLog.Log(entry)
+	return nil
+}
+
+// appliedRecordSets returns the patched record sets as returned by the Abion
+// API, which may normalize them, e.g. fill in the default TTL of the zone. The
+// patched record sets are returned if the response has no records.
+func appliedRecordSets(records map[string]map[string][]internal.Record, resp *internal.APIResponse[*internal.Zone]) map[string]map[string][]internal.Record {
+	if resp == nil || resp.Data == nil || resp.Data.Attributes.Records == nil {
+		return records
+	}
+	applied := make(map[string]map[string][]internal.Record, len(records))
+	for name, recordTypes := range records {
+		applied[name] = make(map[string][]internal.Record, len(recordTypes))
+		for recordType := range recordTypes {
+			applied[name][recordType] = resp.Data.Attributes.Records[name][recordType]
+		}
+	}
+	return applied
+}
+
+// checkZoneUnmodified re-fetches the zone and returns ErrZoneConflict if any of
+// the record sets to patch changed since the zone was read.
+func (p *AbionProvider) checkZoneUnmodified(ctx context.Context, zoneId string, read map[string]map[string][]internal.Record, records map[string]map[string][]internal.Record) error {
+	zone, err := p.Client.GetZone(ctx, zoneId)
+	if err != nil {
+		return err
+	}
+
+	if changed := changedRecordSets(read, zone.Data.Attributes.Records, records); len(changed) > 0 {
+		return fmt.Errorf("%w: zone %s, record sets: %s", ErrZoneConflict, zoneId, strings.Join(changed, ", "))
+	}
 	return nil
 }
 
+func (p *AbionProvider) logDryRunDiff(ctx context.Context, diff *ZoneDiff) {
+	p.dryRunReport.add(diff)
+
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		log.WithContext(ctx).Errorf("unable to marshal dry run diff for zone %s: %v", diff.Zone, err)
+		return
+	}
+	log.WithContext(ctx).WithFields(log.Fields{
+		"zone": diff.Zone,
+		"diff": string(diffJSON),
+	}).Infof("Dry run, changes not applied:\n%s", diff)
+}
+
+// redactTarget returns the target for logging, with the data of TXT records
+// redacted, see logging.RedactTXT.
+func redactTarget(recordType, target string) string {
+	if logging.IsTXT(recordType) {
+		return logging.RedactTXT(target)
+	}
+	return target
+}
+
+func redactRecord(recordType string, record internal.Record) internal.Record {
+	record.Data = redactTarget(recordType, record.Data)
+	return record
+}
+
+// redactTargets joins the targets of a record set for logging and errors.
+func redactTargets(recordType string, targets []string) string {
+	redacted := make([]string, 0, len(targets))
+	for _, target := range targets {
+		redacted = append(redacted, redactTarget(recordType, target))
+	}
+	return strings.Join(redacted, ",")
+}
+
+// redactEndpoints returns the endpoints for logging, with the targets of TXT
+// endpoints redacted.
+func redactEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	redacted := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if logging.IsTXT(ep.RecordType) {
+			ep = ep.DeepCopy()
+			for i, target := range ep.Targets {
+				ep.Targets[i] = logging.RedactTXT(target)
+			}
+		}
+		redacted = append(redacted, ep)
+	}
+	return redacted
+}
+
 func (p *AbionProvider) formatTarget(endpoint *endpoint.Endpoint, target string) string {
-	if endpoint.RecordType == "CNAME" && !strings.HasSuffix(target, ".") {
-		target += "."
+	if endpoint.RecordType == "CNAME" || endpoint.RecordType == aliasRecordType {
+		target = asciiName(target)
+		if !strings.HasSuffix(target, ".") {
+			target += "."
+		}
 	}
 	return target
 }
@@ -467,22 +823,20 @@ func (p *AbionProvider) createRecord(createEndpoint *endpoint.Endpoint, record i
 			Data: target,
 		}
 	}
+	// the comment was rendered by the pre-flight validation before, see recordComment
+	record.Comments, _ = p.recordComment(createEndpoint)
 	return record
 }
 
 func (p *AbionProvider) getAbionDnsName(dnsName string, zoneId string) string {
-	// adjust name to @ or subDomain, e.g. www
-	if zoneId == dnsName {
-		return "@"
-	} else {
-		return strings.TrimSuffix(dnsName, "."+zoneId) // www.abion.com -> www
-	}
+	// adjust name to @ or subDomain, e.g. www.abion.com -> www
+	return relativeName(NormalizeDnsName(dnsName), NormalizeDnsName(zoneId))
 }
 
 func (p *AbionProvider) getExternalDnsDnsName(dnsName string, zoneId string) string {
 	if dnsName == "@" {
-		return zoneId
+		return asciiName(zoneId)
 	} else {
-		return dnsName + "." + zoneId
+		return asciiName(dnsName + "." + zoneId)
 	}
 }
@@ -1,14 +1,35 @@
 package dnsprovider
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/audit"
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging/loggingtest"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/metrics"
+	"github.com/caarlos0/env/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"sigs.k8s.io/external-dns/endpoint"
-	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/plan"
 )
 
 type zonesResponse struct {
@@ -46,6 +67,138 @@ func (c mockClient) PatchZone(ctx context.Context, name string, patch internal.Z
 	return r.APIResponse, r.err
 }
 
+// sequenceClient returns the configured GetZone responses in order, repeating
+// the last one, and records the PatchZone calls.
+type sequenceClient struct {
+	mockClient
+	getZoneResponses []zoneResponse
+	getZoneCalls     int
+	patchZoneCalls   int
+	patches          map[string][]internal.ZoneRequest
+}
+
+func (c *sequenceClient) GetZone(ctx context.Context, name string) (*internal.APIResponse[*internal.Zone], error) {
+	r := c.getZoneResponses[min(c.getZoneCalls, len(c.getZoneResponses)-1)]
+	c.getZoneCalls++
+	return r.APIResponse, r.err
+}
+
+func (c *sequenceClient) PatchZone(ctx context.Context, name string, patch internal.ZoneRequest) (*internal.APIResponse[*internal.Zone], error) {
+	c.patchZoneCalls++
+	if c.patches == nil {
+		c.patches = make(map[string][]internal.ZoneRequest)
+	}
+	c.patches[name] = append(c.patches[name], patch)
+	return c.mockClient.PatchZone(ctx, name, patch)
+}
+
+// zonesClient returns the GetZone response configured per zone and records the
+// zones and records of the PatchZone calls. PatchZone returns the configured
+// errors of the zone in order, successful patches are normalized, applied to the
+// zone and followed by afterPatch, if set. Like the Abion API, PatchZone returns
+// the patched zone.
+type zonesClient struct {
+	mockClient
+	zones      map[string]zoneResponse
+	patchErrs  map[string][]error
+	patched    []string
+	records    []map[string]map[string][]internal.Record
+	afterPatch func(c *zonesClient, name string)
+	// normalize modifies the patched records like the Abion API, e.g. fills
+	// in the default TTL.
+	normalize func(r internal.Record) internal.Record
+}
+
+func (c *zonesClient) GetZone(ctx context.Context, name string) (*internal.APIResponse[*internal.Zone], error) {
+	r := c.zones[name]
+	return r.APIResponse, r.err
+}
+
+func (c *zonesClient) PatchZone(ctx context.Context, name string, patch internal.ZoneRequest) (*internal.APIResponse[*internal.Zone], error) {
+	c.patched = append(c.patched, name)
+	c.records = append(c.records, patch.Data.Attributes.Records)
+	if errs := c.patchErrs[name]; len(errs) > 0 {
+		c.patchErrs[name] = errs[1:]
+		if errs[0] != nil {
+			return nil, errs[0]
+		}
+	}
+	records := patch.Data.Attributes.Records
+	if c.normalize != nil {
+		records = make(map[string]map[string][]internal.Record, len(patch.Data.Attributes.Records))
+		for recordName, recordTypes := range patch.Data.Attributes.Records {
+			records[recordName] = make(map[string][]internal.Record, len(recordTypes))
+			for recordType, recs := range recordTypes {
+				normalized := make([]internal.Record, 0, len(recs))
+				for _, r := range recs {
+					normalized = append(normalized, c.normalize(r))
+				}
+				records[recordName][recordType] = normalized
+			}
+		}
+	}
+	c.apply(name, records)
+	resp := c.zones[name].APIResponse
+	if c.afterPatch != nil {
+		c.afterPatch(c, name)
+	}
+	if resp == nil {
+		return c.mockClient.PatchZone(ctx, name, patch)
+	}
+	return resp, nil
+}
+
+// apply replaces the record sets of the zone, the records read before are not
+// modified.
+func (c *zonesClient) apply(name string, patch map[string]map[string][]internal.Record) {
+	zone, ok := c.zones[name]
+	if !ok || zone.APIResponse == nil {
+		return
+	}
+	records := make(map[string]map[string][]internal.Record)
+	for recordName, recordTypes := range zone.Data.Attributes.Records {
+		records[recordName] = maps.Clone(recordTypes)
+	}
+	for recordName, recordTypes := range patch {
+		if records[recordName] == nil {
+			records[recordName] = make(map[string][]internal.Record)
+		}
+		for recordType, recs := range recordTypes {
+			if len(recs) == 0 {
+				delete(records[recordName], recordType)
+				continue
+			}
+			records[recordName][recordType] = recs
+		}
+	}
+	c.zones[name] = zoneResponse{APIResponse: zoneWithRecords(name, records)}
+}
+
+// stubResolver resolves host names from a map.
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func zoneWithRecords(zoneId string, records map[string]map[string][]internal.Record) *internal.APIResponse[*internal.Zone] {
+	return &internal.APIResponse[*internal.Zone]{
+		Data: &internal.Zone{
+			Type:       "zone",
+			ID:         zoneId,
+			Attributes: internal.Attributes{Records: records},
+		},
+	}
+}
+
 // checkError checks if an error is thrown when expected.
 func checkError(t *testing.T, err error, errExp bool) {
 	isErr := err != nil
@@ -223,20 +376,106 @@ func Test_Records(t *testing.T) {
 	}
 }
 
+func Test_Records_NestedZones(t *testing.T) {
+	client := &sequenceClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+					},
+					Data: []internal.Zone{{ID: "example.com"}, {ID: "dev.example.com"}},
+				},
+			},
+		},
+		getZoneResponses: []zoneResponse{
+			{APIResponse: zoneWithRecords("example.com", map[string]map[string][]internal.Record{
+				"@":       {"A": {{Data: "192.0.2.1"}}},
+				"dev":     {"NS": {{Data: "ns1.abion.com."}}},
+				"api.dev": {"A": {{Data: "192.0.2.2"}}},
+			})},
+			{APIResponse: zoneWithRecords("dev.example.com", map[string]map[string][]internal.Record{
+				"api": {"A": {{Data: "192.0.2.3"}}},
+			})},
+		},
+	}
+	p := AbionProvider{Client: client}
+
+	endpoints, err := p.Records(context.Background())
+	assert.NoError(t, err)
+
+	var actual []string
+	for _, ep := range endpoints {
+		actual = append(actual, ep.DNSName+" "+ep.RecordType+" "+ep.Targets[0])
+	}
+	assert.ElementsMatch(t, []string{"example.com A 192.0.2.1", "api.dev.example.com A 192.0.2.3"}, actual)
+}
+
+func Test_ManagedRecordTypes(t *testing.T) {
+	client := &sequenceClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
+					},
+					Data: []internal.Zone{{ID: "abion.test"}},
+				},
+			},
+		},
+		getZoneResponses: []zoneResponse{
+			{APIResponse: zoneWithRecords("abion.test", map[string]map[string][]internal.Record{
+				"@": {
+					"A":   {{Data: "192.0.2.1"}},
+					"NS":  {{Data: "ns1.abion.com."}},
+					"MX":  {{Data: "10 mail.abion.test."}},
+					"CAA": {{Data: "0 issue \"letsencrypt.org\""}},
+				},
+				"www": {"txt": {{Data: "heritage=external-dns"}}},
+			})},
+		},
+	}
+	p := AbionProvider{Client: client, recordTypes: newRecordTypeFilter([]string{"A", "aaaa", " CNAME", "TXT", ""})}
+
+	endpoints, err := p.Records(context.Background())
+	assert.NoError(t, err)
+	var recordTypes []string
+	for _, ep := range endpoints {
+		recordTypes = append(recordTypes, ep.RecordType)
+	}
+	assert.ElementsMatch(t, []string{"A", "txt"}, recordTypes)
+
+	err = p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+		},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "abion.test", RecordType: "MX", Targets: endpoint.Targets{"10 mail.abion.test"}},
+		},
+	})
+	assert.ErrorIs(t, err, ErrUnmanagedRecordType)
+	assert.ErrorContains(t, err, "MX of abion.test")
+	assert.Zero(t, client.patchZoneCalls)
+
+	// without a filter all record types are managed
+	assert.True(t, AbionProvider{}.recordTypes.managed("MX"))
+	assert.Nil(t, newRecordTypeFilter(nil))
+}
+
 func Test_endpointsByZone(t *testing.T) {
 	type testCase struct {
-		name             string
-		provider         AbionProvider
-		zoneNameIDMapper provider.ZoneIDName
-		endpoints        []*endpoint.Endpoint
-		expected         struct {
+		name      string
+		provider  AbionProvider
+		resolver  *zoneResolver
+		endpoints []*endpoint.Endpoint
+		expected  struct {
 			keys   int
 			values int
 		}
 	}
 
 	run := func(t *testing.T, tc testCase) {
-		actual := tc.provider.endpointsByZone(tc.zoneNameIDMapper, tc.endpoints)
+		actual := tc.provider.endpointsByZone(context.Background(), tc.resolver, tc.endpoints)
 		assert.Equal(t, tc.expected.keys, len(actual))
 
 		count := 0
@@ -248,10 +487,10 @@ func Test_endpointsByZone(t *testing.T) {
 
 	testCases := []testCase{
 		{
-			name:             "Empty zone mapper and empty endpoints",
-			provider:         AbionProvider{},
-			zoneNameIDMapper: provider.ZoneIDName{},
-			endpoints:        []*endpoint.Endpoint{},
+			name:      "Empty zone mapper and empty endpoints",
+			provider:  AbionProvider{},
+			resolver:  newZoneResolver(nil),
+			endpoints: []*endpoint.Endpoint{},
 			expected: struct {
 				keys   int
 				values int
@@ -261,9 +500,9 @@ func Test_endpointsByZone(t *testing.T) {
 			},
 		},
 		{
-			name:             "Empty zone mapper",
-			provider:         AbionProvider{},
-			zoneNameIDMapper: provider.ZoneIDName{},
+			name:     "Empty zone mapper",
+			provider: AbionProvider{},
+			resolver: newZoneResolver(nil),
 			endpoints: []*endpoint.Endpoint{
 				{
 					DNSName: "abion.test",
@@ -280,9 +519,7 @@ func Test_endpointsByZone(t *testing.T) {
 		{
 			name:     "endpoint by zone",
 			provider: AbionProvider{},
-			zoneNameIDMapper: provider.ZoneIDName{
-				"abion.test": "abion.test",
-			},
+			resolver: newZoneResolver([]string{"abion.test"}),
 			endpoints: []*endpoint.Endpoint{
 				{
 					DNSName: "abion.test",
@@ -299,9 +536,7 @@ func Test_endpointsByZone(t *testing.T) {
 		{
 			name:     "zone and subdomain grouped",
 			provider: AbionProvider{},
-			zoneNameIDMapper: provider.ZoneIDName{
-				"abion.test": "abion.test",
-			},
+			resolver: newZoneResolver([]string{"abion.test"}),
 			endpoints: []*endpoint.Endpoint{
 				{
 					DNSName: "abion.test",
@@ -327,7 +562,7 @@ func Test_endpointsByZone(t *testing.T) {
 	}
 }
 
-func Test_populateZoneIdMapper(t *testing.T) {
+func Test_populateZoneResolver(t *testing.T) {
 	type testCase struct {
 		name     string
 		provider AbionProvider
@@ -339,10 +574,10 @@ func Test_populateZoneIdMapper(t *testing.T) {
 	}
 
 	run := func(t *testing.T, tc testCase) {
-		actual, err := tc.provider.populateZoneIdMapper(context.Background())
+		actual, err := tc.provider.populateZoneResolver(context.Background())
 		checkError(t, err, tc.expected.err)
 		if err == nil {
-			id, _ := actual.FindZone(tc.expected.dnsName)
+			id, _, _ := actual.Resolve(tc.expected.dnsName)
 			assert.Equal(t, tc.expected.zoneId, id)
 		}
 	}
@@ -471,6 +706,291 @@ func Test_populateZoneIdMapper(t *testing.T) {
 	}
 }
 
+func Test_zoneResolver(t *testing.T) {
+	type testCase struct {
+		name     string
+		dnsName  string
+		expected struct {
+			zoneId string
+			label  string
+			ok     bool
+		}
+	}
+
+	resolver := newZoneResolver([]string{"example.com", "dev.example.com", "Abion.Test."})
+
+	testCases := []testCase{
+		{
+			name:    "zone apex",
+			dnsName: "example.com",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "example.com", label: "@", ok: true},
+		},
+		{
+			name:    "subdomain",
+			dnsName: "www.example.com",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "example.com", label: "www", ok: true},
+		},
+		{
+			name:    "nested zone apex",
+			dnsName: "dev.example.com",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "dev.example.com", label: "@", ok: true},
+		},
+		{
+			name:    "nested zone wins over parent zone",
+			dnsName: "api.eu.dev.example.com",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "dev.example.com", label: "api.eu", ok: true},
+		},
+		{
+			name:    "label ending like nested zone",
+			dnsName: "www.notdev.example.com",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "example.com", label: "www.notdev", ok: true},
+		},
+		{
+			name:    "case differences",
+			dnsName: "WWW.Example.COM",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "example.com", label: "www", ok: true},
+		},
+		{
+			name:    "trailing dots",
+			dnsName: "www.abion.test.",
+			expected: struct {
+				zoneId string
+				label  string
+				ok     bool
+			}{zoneId: "Abion.Test.", label: "www", ok: true},
+		},
+		{
+			name:    "lookalike suffix",
+			dnsName: "notexample.com",
+		},
+		{
+			name:    "lookalike subdomain",
+			dnsName: "www.notexample.com",
+		},
+		{
+			name:    "unknown zone",
+			dnsName: "example.org",
+		},
+		{
+			name:    "empty name",
+			dnsName: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zoneId, label, ok := resolver.Resolve(tc.dnsName)
+			assert.Equal(t, tc.expected.zoneId, zoneId)
+			assert.Equal(t, tc.expected.label, label)
+			assert.Equal(t, tc.expected.ok, ok)
+		})
+	}
+}
+
+func Test_toASCII(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dnsName  string
+		expected string
+		err      bool
+	}{
+		{"ascii name", "www.abion.test", "www.abion.test", false},
+		{"unicode name", "Bücher.example", "xn--bcher-kva.example", false},
+		{"a-label name", "xn--bcher-kva.example", "xn--bcher-kva.example", false},
+		{"fully qualified name", "bücher.example.", "xn--bcher-kva.example.", false},
+		{"wildcard name", "*.apps.bücher.example", "*.apps.xn--bcher-kva.example", false},
+		{"service label", "_acme-challenge.bücher.example", "_acme-challenge.xn--bcher-kva.example", false},
+		{"invalid a-label", "xn--zz.example", "", true},
+		{"invalid hyphen", "-bad.example", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := toASCII(tc.dnsName)
+			checkError(t, err, tc.err)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrInvalidDnsName)
+				assert.Contains(t, err.Error(), tc.dnsName)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func Test_IDN(t *testing.T) {
+	// unicode and A-label names resolve to the same zone
+	resolver := newZoneResolver([]string{"bücher.example"})
+	zoneId, label, ok := resolver.Resolve("www.xn--bcher-kva.example")
+	assert.True(t, ok)
+	assert.Equal(t, "bücher.example", zoneId)
+	assert.Equal(t, "www", label)
+
+	p := AbionProvider{}
+	assert.Equal(t, "www", p.getAbionDnsName("www.Bücher.example", "xn--bcher-kva.example"))
+	assert.Equal(t, "www.xn--bcher-kva.example", p.getExternalDnsDnsName("www", "bücher.example"))
+	assert.Equal(t, "shop.xn--bcher-kva.example.", p.formatTarget(&endpoint.Endpoint{RecordType: "CNAME"}, "shop.bücher.example"))
+	assert.Equal(t, "bücher", p.formatTarget(&endpoint.Endpoint{RecordType: "TXT"}, "bücher"))
+
+	assert.Equal(t, "xn--bcher-kva.example (bücher.example)", displayName("xn--bcher-kva.example"))
+	assert.Equal(t, "abion.test", displayName("abion.test"))
+
+	adjusted := p.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "www.bücher.example", RecordType: "CNAME", Targets: endpoint.Targets{"shop.bücher.example"}},
+		{DNSName: "-bad.example", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+	})
+	assert.Equal(t, "www.xn--bcher-kva.example", adjusted[0].DNSName)
+	assert.Equal(t, endpoint.Targets{"shop.xn--bcher-kva.example"}, adjusted[0].Targets)
+	assert.Equal(t, "-bad.example", adjusted[1].DNSName)
+
+	// invalid names are rejected with a clear error
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.xn--zz.example", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			{DNSName: "alias.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"-bad.example"}},
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidDnsName)
+	assert.ErrorContains(t, err, `"www.xn--zz.example"`)
+	assert.ErrorContains(t, err, `CNAME target of alias.abion.test`)
+}
+
+func Test_ttlPolicy(t *testing.T) {
+	policy, err := newTTLPolicy(ttlLimits{Min: 60, Max: 86400, Default: 3600}, []string{
+		"example.com=min:300,default:600",
+		"*.dev.example.com=min:5, max:300",
+		"example.org=default:600",
+		"*.example.org=default:900",
+		" ",
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		dnsName  string
+		ttl      endpoint.TTL
+		expected endpoint.TTL
+	}{
+		{"global default", "www.abion.test", 0, 3600},
+		{"global minimum", "www.abion.test", 1, 60},
+		{"global maximum", "www.abion.test", 604800, 86400},
+		{"within limits", "www.abion.test", 120, 120},
+		{"zone override default", "www.example.com", 0, 600},
+		{"zone override minimum", "Example.com.", 120, 300},
+		{"zone override keeps global maximum", "www.example.com", 604800, 86400},
+		{"pattern override", "api.dev.example.com", 1, 5},
+		{"pattern override maximum", "www.api.dev.example.com", 3600, 300},
+		{"pattern does not match its parent", "dev.example.com", 120, 300},
+		{"lookalike zone", "www.notexample.com", 120, 120},
+		{"zone override of zone with pattern", "example.org", 0, 600},
+		{"pattern preferred over parent zone override", "www.example.org", 0, 900},
+		{"pattern preferred over parent zone override below subzone", "www.sub.example.org", 0, 900},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ep := &endpoint.Endpoint{DNSName: tc.dnsName, RecordType: "A", RecordTTL: tc.ttl}
+			policy.apply(context.Background(), ep)
+			assert.Equal(t, tc.expected, ep.RecordTTL)
+		})
+	}
+}
+
+func Test_newTTLPolicy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		global    ttlLimits
+		overrides []string
+		nilPolicy bool
+		err       bool
+	}{
+		{name: "no limits", nilPolicy: true},
+		{name: "override only", overrides: []string{"abion.test=default:300"}},
+		{name: "min greater than max", global: ttlLimits{Min: 600, Max: 300}, err: true},
+		{name: "negative ttl", global: ttlLimits{Default: -1}, err: true},
+		{name: "override exceeds global max", global: ttlLimits{Max: 300}, overrides: []string{"abion.test=min:600"}, err: true},
+		{name: "missing zone", overrides: []string{"=min:60"}, err: true},
+		{name: "unknown key", overrides: []string{"abion.test=ttl:60"}, err: true},
+		{name: "invalid ttl", overrides: []string{"abion.test=min:1m"}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := newTTLPolicy(tc.global, tc.overrides)
+			checkError(t, err, tc.err)
+			if err == nil {
+				assert.Equal(t, tc.nilPolicy, policy == nil)
+			}
+		})
+	}
+}
+
+func Test_ttlPolicy_ApplyChanges(t *testing.T) {
+	policy, err := newTTLPolicy(ttlLimits{Min: 60, Default: 3600}, nil)
+	assert.NoError(t, err)
+
+	client := &sequenceClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
+					},
+					Data: []internal.Zone{{ID: "abion.test"}},
+				},
+			},
+		},
+		getZoneResponses: []zoneResponse{
+			{APIResponse: zoneWithRecords("abion.test", map[string]map[string][]internal.Record{
+				"api": {"A": {{Data: "192.0.2.1", TTL: 300}}},
+			})},
+		},
+	}
+	p := AbionProvider{Client: client, ttlPolicy: policy}
+
+	clamped := testutil.ToFloat64(metrics.TTLClamped.WithLabelValues("A", ttlBoundMin))
+
+	adjusted := p.AdjustEndpoints([]*endpoint.Endpoint{{DNSName: "www.abion.test", RecordType: "A", RecordTTL: 1}})
+	assert.Equal(t, endpoint.TTL(60), adjusted[0].RecordTTL)
+
+	err = p.ApplyChanges(context.Background(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{{DNSName: "www.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}}},
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "api.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 300}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "api.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 10}},
+	})
+	assert.NoError(t, err)
+
+	patches := client.patches["abion.test"]
+	if assert.Len(t, patches, 2) {
+		assert.Equal(t, []internal.Record{{Data: "192.0.2.2", TTL: 3600}}, patches[0].Data.Attributes.Records["www"]["A"])
+		assert.Equal(t, []internal.Record{{Data: "192.0.2.1", TTL: 60}}, patches[1].Data.Attributes.Records["api"]["A"])
+	}
+	assert.Equal(t, clamped+2, testutil.ToFloat64(metrics.TTLClamped.WithLabelValues("A", ttlBoundMin)))
+}
+
 func Test_processCreateActions(t *testing.T) {
 	type testCase struct {
 		name            string
@@ -482,8 +1002,9 @@ func Test_processCreateActions(t *testing.T) {
 	}
 
 	run := func(t *testing.T, tc testCase) {
-		err := tc.provider.processCreateActions(context.Background(), tc.createsByDomain)
-		checkError(t, err, tc.expected.err)
+		results := newApplyResults(ApplyModeFailFast)
+		tc.provider.processCreateActions(context.Background(), tc.createsByDomain, nil, nil, results)
+		checkError(t, results.err(), tc.expected.err)
 	}
 
 	testCases := []testCase{
@@ -506,7 +1027,7 @@ func Test_processCreateActions(t *testing.T) {
 						RecordType: "A",
 					},
 					{
-						DNSName:    "abion.test",
+						DNSName:    "cname.abion.test",
 						Targets:    endpoint.Targets{"test.abion.test"},
 						RecordType: "CNAME",
 					},
@@ -622,8 +1143,9 @@ func Test_processUpdateActions(t *testing.T) {
 	}
 
 	run := func(t *testing.T, tc testCase) {
-		err := tc.provider.processUpdateActions(context.Background(), tc.updatesByDomain, tc.updatesByDomainOld)
-		checkError(t, err, tc.expected.err)
+		results := newApplyResults(ApplyModeFailFast)
+		tc.provider.processUpdateActions(context.Background(), tc.updatesByDomain, tc.updatesByDomainOld, nil, results)
+		checkError(t, results.err(), tc.expected.err)
 	}
 
 	testCases := []testCase{
@@ -661,7 +1183,7 @@ func Test_processUpdateActions(t *testing.T) {
 			expected: struct {
 				err bool
 			}{
-				err: false,
+				err: true,
 			},
 		},
 		{
@@ -794,8 +1316,9 @@ func Test_processDeleteActions(t *testing.T) {
 	}
 
 	run := func(t *testing.T, tc testCase) {
-		err := tc.provider.processDeleteActions(context.Background(), tc.deletesByDomain)
-		checkError(t, err, tc.expected.err)
+		results := newApplyResults(ApplyModeFailFast)
+		tc.provider.processDeleteActions(context.Background(), tc.deletesByDomain, results)
+		checkError(t, results.err(), tc.expected.err)
 	}
 
 	testCases := []testCase{
@@ -832,7 +1355,7 @@ func Test_processDeleteActions(t *testing.T) {
 			expected: struct {
 				err bool
 			}{
-				err: false,
+				err: true,
 			},
 		},
 		{
@@ -1060,6 +1583,32 @@ func Test_getAbionDnsName(t *testing.T) {
 				name: "www",
 			},
 		},
+		{
+			name:     "fully qualified name with different case",
+			provider: AbionProvider{},
+			endpoint: &endpoint.Endpoint{
+				DNSName: "WWW.Abion.Test.",
+			},
+			zoneId: "abion.test",
+			expected: struct {
+				name string
+			}{
+				name: "www",
+			},
+		},
+		{
+			name:     "lookalike suffix is not trimmed",
+			provider: AbionProvider{},
+			endpoint: &endpoint.Endpoint{
+				DNSName: "notabion.test",
+			},
+			zoneId: "abion.test",
+			expected: struct {
+				name string
+			}{
+				name: "notabion.test",
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1107,6 +1656,13 @@ func Test_NewAbionProvider_DomainFilterSplitting(t *testing.T) {
 			expectedDomainIncludes: []string{"example.com"},
 			expectedDomainExcludes: []string{},
 		},
+		{
+			name:                   "internationalized domains converted to A-labels",
+			domainFilter:           []string{"bücher.example", "*.bücher.test"},
+			expectedZoneFilter:     []string{"xn--bcher-kva.example", "*.xn--bcher-kva.test"},
+			expectedDomainIncludes: []string{"xn--bcher-kva.example", "www.xn--bcher-kva.test"},
+			expectedDomainExcludes: []string{"xn--bcher-kva.test"},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1164,6 +1720,8 @@ func Test_matchesZoneFilter(t *testing.T) {
 		{"mixed filter exact match", []string{"exact.com", "*.wild.com"}, "exact.com", true},
 		{"mixed filter wildcard match", []string{"exact.com", "*.wild.com"}, "sub.wild.com", true},
 		{"mixed filter no match", []string{"exact.com", "*.wild.com"}, "other.com", false},
+		{"wildcard does not match lookalike", []string{"*.example.com"}, "notexample.com", false},
+		{"case and trailing dot", []string{"*.Example.com."}, "Sub.example.com", true},
 	}
 
 	for _, tc := range tests {
@@ -1174,58 +1732,542 @@ func Test_matchesZoneFilter(t *testing.T) {
 	}
 }
 
-func Test_getFilteredZoneIDs(t *testing.T) {
-	type testCase struct {
-		name     string
-		provider AbionProvider
-		expected struct {
-			zoneIDs []string
-			err     bool
-		}
-	}
-
-	testCases := []testCase{
-		{
-			name: "no filter returns all zones",
-			provider: AbionProvider{
-				Client: &mockClient{
-					getZones: zonesResponse{
-						APIResponse: &internal.APIResponse[[]internal.Zone]{
-							Meta: &internal.Metadata{
-								Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
-							},
-							Data: []internal.Zone{
-								{ID: "a.com"}, {ID: "b.com"},
-							},
-						},
+func Test_WildcardRecords(t *testing.T) {
+	client := &sequenceClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 3, Total: 3},
 					},
+					Data: []internal.Zone{{ID: "example.com"}, {ID: "sub.example.com"}, {ID: "other.com"}},
 				},
 			},
-			expected: struct {
-				zoneIDs []string
-				err     bool
-			}{zoneIDs: []string{"a.com", "b.com"}},
 		},
-		{
-			name: "plain filter returns filter directly without API call",
-			provider: AbionProvider{
-				zoneFilter: []string{"specific.com"},
-				Client:     &mockClient{}, // no getZones configured - would panic if called incorrectly
+		getZoneResponses: []zoneResponse{
+			{APIResponse: zoneWithRecords("sub.example.com", map[string]map[string][]internal.Record{
+				"*":      {"A": {{Data: "192.0.2.1"}}},
+				"*.apps": {"CNAME": {{Data: "lb.sub.example.com."}}},
+			})},
+		},
+	}
+	p := AbionProvider{
+		Client:       client,
+		zoneFilter:   []string{"*.example.com"},
+		domainFilter: endpoint.NewDomainFilter([]string{domainFilterEntry("*.example.com")}),
+	}
+
+	// wildcard records are read back with their full name
+	endpoints, err := p.Records(context.Background())
+	assert.NoError(t, err)
+	var names []string
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName)
+		assert.True(t, p.GetDomainFilter().Match(ep.DNSName))
+	}
+	assert.ElementsMatch(t, []string{"*.sub.example.com", "*.apps.sub.example.com"}, names)
+
+	// wildcard records are written with the wildcard label, also in escaped form
+	err = p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "*.web.sub.example.com", Targets: endpoint.Targets{"192.0.2.2"}, RecordType: "A"},
+			{DNSName: `\052.api.sub.example.com`, Targets: endpoint.Targets{"192.0.2.3"}, RecordType: "A"},
+		},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "*.sub.example.com", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, client.patches, "example.com")
+
+	patches := client.patches["sub.example.com"]
+	if assert.Len(t, patches, 2) {
+		assert.Equal(t, []internal.Record{{Data: "192.0.2.2"}}, patches[0].Data.Attributes.Records["*.web"]["A"])
+		assert.Equal(t, []internal.Record{{Data: "192.0.2.3"}}, patches[0].Data.Attributes.Records["*.api"]["A"])
+		assert.Contains(t, patches[1].Data.Attributes.Records, "*")
+		assert.Empty(t, patches[1].Data.Attributes.Records["*"]["A"])
+	}
+}
+
+func Test_ApexCNAME(t *testing.T) {
+	zones := zonesResponse{
+		APIResponse: &internal.APIResponse[[]internal.Zone]{
+			Meta: &internal.Metadata{
+				Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
 			},
-			expected: struct {
-				zoneIDs []string
-				err     bool
-			}{zoneIDs: []string{"specific.com"}},
+			Data: []internal.Zone{{ID: "abion.test"}},
 		},
-		{
-			name: "wildcard filter fetches all zones and matches",
-			provider: AbionProvider{
-				zoneFilter: []string{"*.example.com"},
-				Client: &mockClient{
-					getZones: zonesResponse{
-						APIResponse: &internal.APIResponse[[]internal.Zone]{
-							Meta: &internal.Metadata{
-								Pagination: &internal.Pagination{Offset: 0, Limit: 3, Total: 3},
+	}
+	apexCNAME := &endpoint.Endpoint{DNSName: "abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 300}
+
+	t.Run("reject", func(t *testing.T) {
+		client := &sequenceClient{mockClient: mockClient{getZones: zones}}
+		p := AbionProvider{Client: client, apexCNAMEMode: ApexCNAMEReject}
+
+		err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{apexCNAME.DeepCopy()}})
+		assert.ErrorIs(t, err, ErrApexCNAME)
+		var zoneErr *ZoneError
+		if assert.ErrorAs(t, err, &zoneErr) {
+			assert.Equal(t, "abion.test", zoneErr.Zone)
+		}
+		assert.Zero(t, client.patchZoneCalls)
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		client := &sequenceClient{
+			mockClient: mockClient{getZones: zones},
+			getZoneResponses: []zoneResponse{
+				{APIResponse: zoneWithRecords("abion.test", map[string]map[string][]internal.Record{
+					"@":   {"ALIAS": {{Data: "lb.example.net.", TTL: 300}}, "TXT": {{Data: "v=spf1 -all"}}},
+					"www": {"CNAME": {{Data: "abion.test."}}},
+				})},
+			},
+		}
+		p := AbionProvider{Client: client, apexCNAMEMode: ApexCNAMEAlias}
+
+		endpoints, err := p.Records(context.Background())
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"abion.test CNAME lb.example.net", "abion.test TXT v=spf1 -all", "www.abion.test CNAME abion.test"}, endpointStrings(endpoints))
+
+		client = &sequenceClient{
+			mockClient:       mockClient{getZones: zones},
+			getZoneResponses: []zoneResponse{{APIResponse: zoneWithRecords("abion.test", nil)}},
+		}
+		p.Client = client
+		err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{apexCNAME.DeepCopy()}})
+		assert.NoError(t, err)
+		if assert.Len(t, client.patches["abion.test"], 1) {
+			records := client.patches["abion.test"][0].Data.Attributes.Records["@"]
+			assert.Equal(t, []internal.Record{{Data: "lb.example.net.", TTL: 300}}, records["ALIAS"])
+			assert.NotContains(t, records, "CNAME")
+		}
+	})
+
+	t.Run("flatten", func(t *testing.T) {
+		client := &sequenceClient{
+			mockClient: mockClient{getZones: zones},
+			getZoneResponses: []zoneResponse{
+				{APIResponse: zoneWithRecords("abion.test", map[string]map[string][]internal.Record{
+					"@": {
+						"A": {
+							{Data: "192.0.2.10", TTL: 300, Comments: flattenedComment("lb.example.net")},
+							{Data: "192.0.2.99", TTL: 300},
+							// a manual comment looking like the marker doesn't make the record flattened
+							{Data: "192.0.2.98", TTL: 300, Comments: "flattened from CNAME lb.example.net"},
+						},
+						"AAAA": {{Data: "2001:db8::10", TTL: 300, Comments: flattenedComment("lb.example.net")}},
+					},
+				})},
+			},
+		}
+		p := AbionProvider{
+			Client:        client,
+			apexCNAMEMode: ApexCNAMEFlatten,
+			hostResolver:  stubResolver{"lb.example.net": {"192.0.2.11", "2001:db8::11"}},
+		}
+
+		// flattened records are read back as the apex CNAME
+		endpoints, err := p.Records(context.Background())
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"abion.test CNAME lb.example.net", "abion.test A 192.0.2.99", "abion.test A 192.0.2.98"}, endpointStrings(endpoints))
+
+		err = p.ApplyChanges(context.Background(), &plan.Changes{
+			Create: []*endpoint.Endpoint{apexCNAME.DeepCopy()},
+			Delete: []*endpoint.Endpoint{apexCNAME.DeepCopy()},
+		})
+		assert.NoError(t, err)
+
+		patches := client.patches["abion.test"]
+		if assert.Len(t, patches, 2) {
+			comment := "flattened from CNAME lb.example.net (" + flattenedChecksum("lb.example.net") + ")"
+			created := patches[0].Data.Attributes.Records["@"]
+			assert.Contains(t, created["A"], internal.Record{Data: "192.0.2.11", TTL: 300, Comments: comment})
+			assert.Contains(t, created["AAAA"], internal.Record{Data: "2001:db8::11", TTL: 300, Comments: comment})
+
+			// only the flattened records are deleted
+			deleted := patches[1].Data.Attributes.Records["@"]
+			assert.Equal(t, []internal.Record{
+				{Data: "192.0.2.99", TTL: 300},
+				{Data: "192.0.2.98", TTL: 300, Comments: "flattened from CNAME lb.example.net"},
+			}, deleted["A"])
+			assert.Empty(t, deleted["AAAA"])
+		}
+
+		// unresolvable targets fail the zone
+		p.hostResolver = stubResolver{}
+		err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{apexCNAME.DeepCopy()}})
+		assert.ErrorContains(t, err, "unable to flatten apex CNAME abion.test to lb.example.net")
+	})
+}
+
+func Test_Preflight(t *testing.T) {
+	zones := zonesResponse{
+		APIResponse: &internal.APIResponse[[]internal.Zone]{
+			Meta: &internal.Metadata{
+				Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
+			},
+			Data: []internal.Zone{{ID: "abion.test"}},
+		},
+	}
+	current := map[string]map[string][]internal.Record{
+		"www":  {"TXT": {{Data: "heritage=external-dns"}}},
+		"mail": {"MX": {{Data: "10 mx.abion.test."}}},
+		"api":  {"CNAME": {{Data: "lb.abion.test."}}},
+		"old":  {"A": {{Data: "192.0.2.1"}}},
+	}
+
+	testCases := []struct {
+		name    string
+		changes *plan.Changes
+		errs    []error
+		errMsgs []string
+		patched []string
+		reads   int
+	}{
+		{
+			name: "CNAME conflicts with existing record",
+			changes: &plan.Changes{Create: []*endpoint.Endpoint{
+				{DNSName: "www.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"lb.abion.test"}},
+				{DNSName: "new.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+			}},
+			errs:    []error{ErrCNAMEConflict},
+			errMsgs: []string{"www.abion.test CNAME lb.abion.test: CNAME record conflicts with other records on the same name, conflicts with existing record www.abion.test TXT heritage=external-dns"},
+			patched: []string{"new/A"},
+			reads:   2,
+		},
+		{
+			name: "record conflicts with existing CNAME",
+			changes: &plan.Changes{Create: []*endpoint.Endpoint{
+				{DNSName: "api.abion.test", RecordType: "TXT", Targets: endpoint.Targets{"heritage=external-dns"}},
+			}},
+			errs:    []error{ErrCNAMEConflict},
+			errMsgs: []string{"conflicts with existing record api.abion.test CNAME lb.abion.test."},
+			reads:   1,
+		},
+		{
+			name: "CNAME conflicts with created record",
+			changes: &plan.Changes{Create: []*endpoint.Endpoint{
+				{DNSName: "new.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"lb.abion.test"}},
+				{DNSName: "new.abion.test", RecordType: "TXT", Targets: endpoint.Targets{"heritage=external-dns"}},
+			}},
+			errs:    []error{ErrCNAMEConflict},
+			errMsgs: []string{"new.abion.test CNAME lb.abion.test: CNAME record conflicts with other records on the same name, conflicts with endpoint new.abion.test TXT heritage=external-dns"},
+			patched: []string{"new/TXT"},
+			reads:   2,
+		},
+		{
+			name: "CNAME replacing deleted record",
+			changes: &plan.Changes{
+				Create: []*endpoint.Endpoint{{DNSName: "old.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"lb.abion.test"}}},
+				Delete: []*endpoint.Endpoint{{DNSName: "old.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}}},
+			},
+			patched: []string{"old/CNAME", "old/A"},
+			reads:   4,
+		},
+		{
+			name: "CNAME with multiple targets",
+			changes: &plan.Changes{Create: []*endpoint.Endpoint{
+				{DNSName: "new.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"a.abion.test", "b.abion.test"}},
+			}},
+			errs:  []error{ErrCNAMEConflict},
+			reads: 1,
+		},
+		{
+			name: "duplicate targets",
+			changes: &plan.Changes{Create: []*endpoint.Endpoint{
+				{DNSName: "new.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2", "192.0.2.2"}},
+				{DNSName: "old.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			}},
+			errs:    []error{ErrDuplicateTarget, ErrDuplicateTarget},
+			errMsgs: []string{"duplicate target 192.0.2.2", "duplicate target 192.0.2.1, conflicts with existing record old.abion.test A 192.0.2.1"},
+			reads:   1,
+		},
+		{
+			name: "invalid rdata",
+			changes: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					{DNSName: "a.abion.test", RecordType: "A", Targets: endpoint.Targets{"2001:db8::1"}},
+					{DNSName: "aaaa.abion.test", RecordType: "AAAA", Targets: endpoint.Targets{"192.0.2.1"}},
+					{DNSName: "cname.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"192.0.2.1"}},
+					{DNSName: "mx.abion.test", RecordType: "MX", Targets: endpoint.Targets{"mx.abion.test"}},
+					{DNSName: "srv.abion.test", RecordType: "SRV", Targets: endpoint.Targets{"10 5 http svc.abion.test"}},
+					{DNSName: "txt.abion.test", RecordType: "TXT", Targets: endpoint.Targets{""}},
+				},
+				UpdateOld: []*endpoint.Endpoint{{DNSName: "old.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}}},
+				UpdateNew: []*endpoint.Endpoint{{DNSName: "old.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.300"}}},
+			},
+			errs:    []error{ErrInvalidTarget, ErrInvalidTarget, ErrInvalidTarget, ErrInvalidTarget, ErrInvalidTarget, ErrInvalidTarget, ErrInvalidTarget},
+			errMsgs: []string{"not an IPv4 address", "not an IPv6 address", "not a host name", "expected <preference> <exchange>", "expected <priority> <weight> <port> <target>", "empty TXT target"},
+			reads:   2,
+		},
+		{
+			name: "valid update",
+			changes: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{{DNSName: "mail.abion.test", RecordType: "MX", Targets: endpoint.Targets{"10 mx.abion.test"}}},
+				UpdateNew: []*endpoint.Endpoint{{DNSName: "mail.abion.test", RecordType: "MX", Targets: endpoint.Targets{"20 mx.abion.test"}}},
+			},
+			patched: []string{"mail/MX"},
+			reads:   2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &sequenceClient{
+				mockClient:       mockClient{getZones: zones},
+				getZoneResponses: []zoneResponse{{APIResponse: zoneWithRecords("abion.test", current)}},
+			}
+			p := AbionProvider{Client: client}
+
+			err := p.ApplyChanges(context.Background(), tc.changes)
+			if len(tc.errs) == 0 {
+				assert.NoError(t, err)
+			} else {
+				var zoneErr *ZoneError
+				if assert.ErrorAs(t, err, &zoneErr) {
+					assert.Equal(t, "abion.test", zoneErr.Zone)
+					assert.Len(t, zoneErr.Err.(interface{ Unwrap() []error }).Unwrap(), len(tc.errs))
+				}
+				for _, e := range tc.errs {
+					assert.ErrorIs(t, err, e)
+				}
+				assert.False(t, errors.Is(err, SoftError))
+			}
+			for _, msg := range tc.errMsgs {
+				assert.ErrorContains(t, err, msg)
+			}
+
+			// the zone is read once per patch to validate the changes and re-read before patching
+			assert.Equal(t, tc.reads, client.getZoneCalls)
+
+			var patched []string
+			for _, patch := range client.patches["abion.test"] {
+				for name, recordTypes := range patch.Data.Attributes.Records {
+					for recordType := range recordTypes {
+						patched = append(patched, name+"/"+recordType)
+					}
+				}
+			}
+			assert.Equal(t, tc.patched, patched)
+		})
+	}
+}
+
+// testRedactor returns a redactor of the secret-key API key with the default
+// TXT redact patterns.
+func testRedactor(t *testing.T) *logging.Redactor {
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	r, err := logging.NewRedactor([]string{"secret-key"}, config.LogRedactTXTPatterns)
+	assert.NoError(t, err)
+	return r
+}
+
+func Test_ApplyChanges_RedactsTXTRecordData(t *testing.T) {
+	const (
+		acme  = "Zm9vYmFyYmF6cXV4cXV1eGNvcmdlZ3JhdWx0Z2FycGx"
+		label = "abcdefghijklmnopqrstuvwxyz0123456789abcdefg"
+	)
+	buf := loggingtest.Capture(t, "secret-key")
+
+	client := &sequenceClient{
+		mockClient: mockClient{getZones: zonesResponse{
+			APIResponse: &internal.APIResponse[[]internal.Zone]{
+				Meta: &internal.Metadata{Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1}},
+				Data: []internal.Zone{{ID: "abion.test"}},
+			},
+		}},
+		getZoneResponses: []zoneResponse{{APIResponse: zoneWithRecords("abion.test", map[string]map[string][]internal.Record{
+			"www": {"TXT": {{Data: acme}}},
+		})}},
+	}
+	p := AbionProvider{Client: client}
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "_acme-challenge.abion.test", RecordType: "TXT", Targets: endpoint.Targets{acme}},
+		{DNSName: label + ".abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+		{DNSName: "www.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"lb.abion.test"}},
+	}})
+
+	assert.ErrorContains(t, err, "conflicts with existing record www.abion.test TXT "+configuration.RedactedValue)
+	assert.NotContains(t, err.Error(), acme)
+
+	output := buf.String()
+	assert.Contains(t, output, "Create records")
+	assert.Contains(t, output, "Rejecting change of zone abion.test")
+	assert.NotContains(t, output, acme)
+	assert.Contains(t, output, label, "TXT patterns must only be applied to TXT record data")
+
+	// the patch itself is not redacted
+	assert.Equal(t, acme, client.patches["abion.test"][0].Data.Attributes.Records["_acme-challenge"]["TXT"][0].Data)
+}
+
+func Test_RecordComments(t *testing.T) {
+	tmpl, err := newCommentTemplate("managed-by=external-dns owner={{.Owner}} resource={{.Resource}}")
+	assert.NoError(t, err)
+
+	client := &sequenceClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
+					},
+					Data: []internal.Zone{{ID: "abion.test"}},
+				},
+			},
+		},
+		getZoneResponses: []zoneResponse{
+			{APIResponse: zoneWithRecords("abion.test", map[string]map[string][]internal.Record{
+				"www": {"A": {{Data: "192.0.2.1", Comments: "added by hand"}}},
+				"api": {"A": {
+					{Data: "192.0.2.2", Comments: "managed-by=external-dns owner=default resource=ingress/default/api"},
+					{Data: "192.0.2.3", Comments: "added by hand"},
+				}},
+			})},
+		},
+	}
+	p := AbionProvider{Client: client, commentTmpl: tmpl}
+
+	labels := endpoint.Labels{endpoint.OwnerLabelKey: "default", endpoint.ResourceLabelKey: "service/default/example-service"}
+	err = p.ApplyChanges(context.Background(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{{DNSName: "www.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.4"}, Labels: labels}},
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "api.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "api.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.5"}, Labels: labels}},
+	})
+	assert.NoError(t, err)
+
+	comment := "managed-by=external-dns owner=default resource=service/default/example-service"
+	patches := client.patches["abion.test"]
+	if assert.Len(t, patches, 2) {
+		assert.Equal(t, []internal.Record{
+			{Data: "192.0.2.4", Comments: comment},
+			{Data: "192.0.2.1", Comments: "added by hand"},
+		}, patches[0].Data.Attributes.Records["www"]["A"])
+		assert.Equal(t, []internal.Record{
+			{Data: "192.0.2.5", Comments: comment},
+			{Data: "192.0.2.3", Comments: "added by hand"},
+		}, patches[1].Data.Attributes.Records["api"]["A"])
+	}
+
+	// flattened apex CNAMEs keep their marker comment
+	flattened := newFlattenedEndpoint(&endpoint.Endpoint{DNSName: "abion.test", Labels: labels}, "lb.example.net", "A")
+	comment, err = p.recordComment(flattened)
+	assert.NoError(t, err)
+	assert.Equal(t, flattenedComment("lb.example.net"), comment)
+}
+
+func Test_RecordComments_TemplateError(t *testing.T) {
+	// the template only fails for endpoints with an owner
+	tmpl, err := newCommentTemplate("{{if .Owner}}{{index .Resource 100}}{{end}}")
+	assert.NoError(t, err)
+
+	client := &sequenceClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
+					},
+					Data: []internal.Zone{{ID: "abion.test"}},
+				},
+			},
+		},
+		getZoneResponses: []zoneResponse{{APIResponse: zoneWithRecords("abion.test", nil)}},
+	}
+	p := AbionProvider{Client: client, commentTmpl: tmpl}
+
+	labels := endpoint.Labels{endpoint.OwnerLabelKey: "default", endpoint.ResourceLabelKey: "service/default/example-service"}
+	err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, Labels: labels},
+		{DNSName: "api.abion.test", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+	}})
+
+	// the endpoint is rejected instead of written without comment
+	var endpointErr *EndpointError
+	if assert.ErrorAs(t, err, &endpointErr) {
+		assert.Equal(t, "www.abion.test", endpointErr.Endpoint.DNSName)
+	}
+	assert.ErrorIs(t, err, ErrRecordComment)
+	if assert.Len(t, client.patches["abion.test"], 1) {
+		records := client.patches["abion.test"][0].Data.Attributes.Records
+		assert.NotContains(t, records, "www")
+		assert.Equal(t, []internal.Record{{Data: "192.0.2.2"}}, records["api"]["A"])
+	}
+}
+
+func Test_newCommentTemplate(t *testing.T) {
+	tmpl, err := newCommentTemplate(" ")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = newCommentTemplate("owner={{.Owner")
+	assert.ErrorContains(t, err, "invalid record comment template")
+
+	_, err = newCommentTemplate("owner={{.Namespace}}")
+	assert.ErrorContains(t, err, "can't evaluate field Namespace")
+}
+
+func endpointStrings(endpoints []*endpoint.Endpoint) []string {
+	var actual []string
+	for _, ep := range endpoints {
+		actual = append(actual, ep.DNSName+" "+ep.RecordType+" "+strings.Join(ep.Targets, ","))
+	}
+	return actual
+}
+
+func Test_getFilteredZoneIDs(t *testing.T) {
+	type testCase struct {
+		name     string
+		provider AbionProvider
+		expected struct {
+			zoneIDs []string
+			err     bool
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name: "no filter returns all zones",
+			provider: AbionProvider{
+				Client: &mockClient{
+					getZones: zonesResponse{
+						APIResponse: &internal.APIResponse[[]internal.Zone]{
+							Meta: &internal.Metadata{
+								Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+							},
+							Data: []internal.Zone{
+								{ID: "a.com"}, {ID: "b.com"},
+							},
+						},
+					},
+				},
+			},
+			expected: struct {
+				zoneIDs []string
+				err     bool
+			}{zoneIDs: []string{"a.com", "b.com"}},
+		},
+		{
+			name: "plain filter returns filter directly without API call",
+			provider: AbionProvider{
+				zoneFilter: []string{"specific.com"},
+				Client:     &mockClient{}, // no getZones configured - would panic if called incorrectly
+			},
+			expected: struct {
+				zoneIDs []string
+				err     bool
+			}{zoneIDs: []string{"specific.com"}},
+		},
+		{
+			name: "wildcard filter fetches all zones and matches",
+			provider: AbionProvider{
+				zoneFilter: []string{"*.example.com"},
+				Client: &mockClient{
+					getZones: zonesResponse{
+						APIResponse: &internal.APIResponse[[]internal.Zone]{
+							Meta: &internal.Metadata{
+								Pagination: &internal.Pagination{Offset: 0, Limit: 3, Total: 3},
 							},
 							Data: []internal.Zone{
 								{ID: "sub.example.com"},
@@ -1254,6 +2296,36 @@ func Test_getFilteredZoneIDs(t *testing.T) {
 	}
 }
 
+func Test_getFilteredZoneIDs_Cache(t *testing.T) {
+	p := AbionProvider{
+		zoneCache: newZoneCache(time.Minute),
+		Client: &mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 1, Total: 1},
+					},
+					Data: []internal.Zone{{ID: "a.com"}},
+				},
+			},
+		},
+	}
+
+	zoneIDs, err := p.getFilteredZoneIDs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.com"}, zoneIDs)
+
+	// cached zones are returned without calling the API
+	p.Client = &mockClient{getZones: zonesResponse{err: errors.New("unavailable")}}
+	zoneIDs, err = p.getFilteredZoneIDs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.com"}, zoneIDs)
+
+	p.FlushCache()
+	_, err = p.getFilteredZoneIDs(context.Background())
+	assert.Error(t, err)
+}
+
 func Test_getExternalDnsDnsName(t *testing.T) {
 	type testCase struct {
 		name         string
@@ -1301,3 +2373,673 @@ func Test_getExternalDnsDnsName(t *testing.T) {
 		})
 	}
 }
+
+func Test_submitPatchZone_AuditLog(t *testing.T) {
+	current := map[string]map[string][]internal.Record{
+		"www": {
+			"A": {{TTL: 3600, Data: "172.16.0.1"}},
+		},
+	}
+	records := map[string]map[string][]internal.Record{
+		"www": {
+			"A": {{TTL: 300, Data: "172.16.0.2"}},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		dryRun   bool
+		patchErr error
+		outcome  string
+	}{
+		{name: "applied", outcome: audit.OutcomeApplied},
+		{name: "dry run", dryRun: true, outcome: audit.OutcomeDryRun},
+		{name: "failed", patchErr: &internal.Error{Status: 400, Message: "invalid rdata secret-key"}, outcome: audit.OutcomeFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := AbionProvider{
+				Client: &mockClient{
+					patchZone: patchZoneResponse{err: tc.patchErr},
+					getZone:   zoneResponse{APIResponse: zoneWithRecords("abion.test", current)},
+				},
+				DryRun:   tc.dryRun,
+				auditLog: audit.NewWithWriter(&buf, testRedactor(t)),
+			}
+			ctx := internal.WithRequestID(context.Background(), "req-1")
+
+			err := p.submitPatchZone(ctx, "abion.test", current, records)
+			checkError(t, err, tc.patchErr != nil)
+
+			var entry audit.Entry
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, "abion.test", entry.Zone)
+			assert.Equal(t, "req-1", entry.RequestID)
+			assert.Equal(t, tc.dryRun, entry.DryRun)
+			assert.Equal(t, tc.outcome, entry.Outcome)
+			assert.Equal(t, []audit.Change{{
+				Name:   "www",
+				Type:   "A",
+				Before: []audit.RecordData{{Data: "172.16.0.1", TTL: 3600}},
+				After:  []audit.RecordData{{Data: "172.16.0.2", TTL: 300}},
+			}}, entry.Changes)
+			assert.NotContains(t, buf.String(), "secret-key")
+		})
+	}
+}
+
+func Test_submitPatchZone_AuditLog_TXTRecords(t *testing.T) {
+	const acme = "Zm9vYmFyYmF6cXV4cXV1eGNvcmdlZ3JhdWx0Z2FycGx"
+	current := map[string]map[string][]internal.Record{
+		"_acme-challenge": {"TXT": {{TTL: 300, Data: "\"" + acme + "\""}}},
+	}
+	records := map[string]map[string][]internal.Record{
+		"_acme-challenge": {"TXT": {}},
+		// names and data of other record types of the TXT pattern length are kept
+		"abcdefghijklmnopqrstuvwxyz0123456789abcdefg": {"CNAME": {{TTL: 300, Data: "abcdefghijklmnopqrstuvwxyz0123456789abcdefg.abion.test."}}},
+	}
+
+	var buf bytes.Buffer
+	p := AbionProvider{
+		Client:   &mockClient{getZone: zoneResponse{APIResponse: zoneWithRecords("abion.test", current)}},
+		auditLog: audit.NewWithWriter(&buf, testRedactor(t)),
+	}
+
+	assert.NoError(t, p.submitPatchZone(context.Background(), "abion.test", current, records))
+
+	var entry audit.Entry
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, []audit.Change{
+		{
+			Name:   "_acme-challenge",
+			Type:   "TXT",
+			Before: []audit.RecordData{{Data: "\"" + configuration.RedactedValue + "\"", TTL: 300}},
+			After:  []audit.RecordData{},
+		},
+		{
+			Name:   "abcdefghijklmnopqrstuvwxyz0123456789abcdefg",
+			Type:   "CNAME",
+			Before: []audit.RecordData{},
+			After:  []audit.RecordData{{Data: "abcdefghijklmnopqrstuvwxyz0123456789abcdefg.abion.test.", TTL: 300}},
+		},
+	}, entry.Changes)
+	assert.NotContains(t, buf.String(), acme)
+}
+
+func Test_computeZoneDiff(t *testing.T) {
+	current := map[string]map[string][]internal.Record{
+		"www": {
+			"A":   {{TTL: 3600, Data: "172.16.0.1"}, {TTL: 3600, Data: "172.16.0.2"}},
+			"TXT": {{TTL: 3600, Data: "untouched"}},
+		},
+		"api": {
+			"CNAME": {{TTL: 3600, Data: "www.abion.test."}},
+		},
+	}
+	patch := map[string]map[string][]internal.Record{
+		"www": {
+			"A": {{TTL: 300, Data: "172.16.0.1"}, {Data: "172.16.0.3"}},
+		},
+		"api": {
+			"CNAME": {},
+		},
+		"@": {
+			"A": {{Data: "172.16.0.4"}},
+		},
+	}
+
+	diff := computeZoneDiff("abion.test", current, patch)
+
+	assert.Equal(t, "abion.test", diff.Zone)
+	assert.Equal(t, []RecordChange{
+		{Name: "@", Type: "A", Data: "172.16.0.4"},
+		{Name: "www", Type: "A", Data: "172.16.0.3"},
+	}, diff.Added)
+	assert.Equal(t, []RecordChange{
+		{Name: "api", Type: "CNAME", Data: "www.abion.test.", TTL: 3600},
+		{Name: "www", Type: "A", Data: "172.16.0.2", TTL: 3600},
+	}, diff.Removed)
+	assert.Equal(t, []RecordChange{
+		{Name: "www", Type: "A", Data: "172.16.0.1", TTL: 300, OldTTL: 3600},
+	}, diff.Changed)
+	assert.Equal(t, DiffSummary{Zone: "abion.test", Added: 2, Removed: 2, Changed: 1}, diff.Summary())
+	assert.Contains(t, diff.String(), "~ www A 172.16.0.1 ttl 3600 -> 300")
+}
+
+func Test_DryRunReport(t *testing.T) {
+	p := AbionProvider{
+		Client:       &mockClient{},
+		DryRun:       true,
+		dryRunReport: newDryRunReport(),
+	}
+	current := map[string]map[string][]internal.Record{}
+	p.dryRunReport.reset()
+
+	assert.NoError(t, p.submitPatchZone(context.Background(), "abion.test", current, map[string]map[string][]internal.Record{
+		"www": {"A": {{Data: "172.16.0.1"}}},
+	}))
+	assert.NoError(t, p.submitPatchZone(context.Background(), "abion.test", current, map[string]map[string][]internal.Record{
+		"api": {"A": {{Data: "172.16.0.2"}}},
+	}))
+
+	_, summaries := p.DryRunReport().Summaries()
+	assert.Equal(t, []DiffSummary{{Zone: "abion.test", Added: 2}}, summaries)
+}
+
+func Test_processZoneCreateActions_Conflict(t *testing.T) {
+	read := map[string]map[string][]internal.Record{
+		"www": {"A": {{TTL: 3600, Data: "172.16.0.1"}}},
+	}
+	testCases := []struct {
+		name      string
+		refetched map[string]map[string][]internal.Record
+		conflict  bool
+	}{
+		{
+			name:      "unmodified zone is patched",
+			refetched: read,
+		},
+		{
+			name: "modification of other record sets is ignored",
+			refetched: map[string]map[string][]internal.Record{
+				"www": {"A": {{TTL: 3600, Data: "172.16.0.1"}}},
+				"api": {"A": {{TTL: 3600, Data: "172.16.0.9"}}},
+			},
+		},
+		{
+			name: "modified record set is a conflict",
+			refetched: map[string]map[string][]internal.Record{
+				"www": {"A": {{TTL: 3600, Data: "172.16.0.1"}, {TTL: 3600, Data: "172.16.0.9"}}},
+			},
+			conflict: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &sequenceClient{getZoneResponses: []zoneResponse{
+				{APIResponse: zoneWithRecords("abion.test", read)},
+				{APIResponse: zoneWithRecords("abion.test", tc.refetched)},
+			}}
+			p := AbionProvider{Client: client, zoneLocks: newZoneLocker()}
+
+			err := p.processZoneCreateActions(context.Background(), "abion.test", []*endpoint.Endpoint{
+				{DNSName: "www.abion.test", Targets: endpoint.Targets{"172.16.0.2"}, RecordType: "A"},
+			}, nil, nil)
+
+			if tc.conflict {
+				assert.ErrorIs(t, err, ErrZoneConflict)
+				assert.Equal(t, 0, client.patchZoneCalls)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, client.patchZoneCalls)
+			}
+		})
+	}
+}
+
+// callLogClient serves a zone with the record old A 192.0.2.1 and logs the
+// request IDs of the GetZone and PatchZone calls. The first PatchZone call
+// blocks until release is closed.
+type callLogClient struct {
+	mockClient
+	mu      sync.Mutex
+	calls   []string
+	once    sync.Once
+	patched chan struct{}
+	release chan struct{}
+}
+
+func (c *callLogClient) log(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, internal.RequestIDFromContext(ctx))
+}
+
+func (c *callLogClient) GetZone(ctx context.Context, name string) (*internal.APIResponse[*internal.Zone], error) {
+	c.log(ctx)
+	return zoneWithRecords(name, map[string]map[string][]internal.Record{
+		"old": {"A": {{Data: "192.0.2.1"}}},
+	}), nil
+}
+
+func (c *callLogClient) PatchZone(ctx context.Context, name string, patch internal.ZoneRequest) (*internal.APIResponse[*internal.Zone], error) {
+	c.log(ctx)
+	c.once.Do(func() {
+		close(c.patched)
+		<-c.release
+	})
+	return nil, nil
+}
+
+func Test_ApplyChanges_ZoneLock(t *testing.T) {
+	client := &callLogClient{patched: make(chan struct{}), release: make(chan struct{})}
+	p := AbionProvider{Client: client, zoneFilter: []string{"abion.test"}, zoneLocks: newZoneLocker()}
+
+	var wg sync.WaitGroup
+	apply := func(requestID string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.ApplyChanges(internal.WithRequestID(context.Background(), requestID), &plan.Changes{
+				Create: []*endpoint.Endpoint{{DNSName: "new.abion.test", Targets: endpoint.Targets{"192.0.2.2"}, RecordType: "A"}},
+				Delete: []*endpoint.Endpoint{{DNSName: "old.abion.test", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A"}},
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	// the second call waits for the zone lock while the first one is patching
+	apply("first")
+	<-client.patched
+	apply("second")
+	time.Sleep(20 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	// the create and delete phases of the calls are not interleaved
+	n := slices.Index(client.calls, "second")
+	if assert.Positive(t, n) {
+		assert.Equal(t, slices.Repeat([]string{"first"}, n), client.calls[:n])
+		assert.Equal(t, slices.Repeat([]string{"second"}, len(client.calls)-n), client.calls[n:])
+		assert.Len(t, client.calls, 2*n)
+	}
+}
+
+func Test_zoneLocker(t *testing.T) {
+	l := newZoneLocker()
+	var counter int
+
+	// locking the same zones in different order and spelling doesn't deadlock
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			zones := []string{"a.test", "B.test."}
+			if i%2 == 0 {
+				zones = []string{"b.test", "a.test", "A.test"}
+			}
+			unlock := l.lock(zones...)
+			defer unlock()
+			counter++
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, counter)
+	assert.Len(t, l.locks, 2)
+
+	var nilLocker *zoneLocker
+	nilLocker.lock("a.test")()
+}
+
+func Test_classifyError(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		soft bool
+	}{
+		{"rate limited", &internal.Error{Status: 429, Message: "Too Many Requests"}, true},
+		{"circuit open", &ZoneError{Zone: "abion.test", Err: internal.ErrCircuitOpen}, true},
+		{"server error", &ZoneError{Zone: "abion.test", Err: &internal.Error{Status: 503, Message: "Service Unavailable"}}, true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"transport error", &url.Error{Op: "Get", URL: "https://api.abion.com", Err: errors.New("connection refused")}, true},
+		{"zone conflict", &ZoneError{Zone: "abion.test", Err: ErrZoneConflict}, true},
+		{"forbidden", &internal.Error{Status: 403, Message: "Forbidden"}, false},
+		{"bad request", &ZoneError{Zone: "abion.test", Err: &internal.Error{Status: 400, Message: "invalid rdata"}}, false},
+		{"permanent and transient zone errors", &ApplyError{Zones: []*ZoneError{
+			{Zone: "a.test", Err: errors.Join(&internal.Error{Status: 400, Message: "invalid rdata"})},
+			{Zone: "b.test", Err: errors.Join(&url.Error{Op: "Patch", URL: "https://api.abion.com", Err: errors.New("connection reset")})},
+		}}, true},
+		{"transient zone error joined with a permanent one", &ApplyError{Zones: []*ZoneError{
+			{Zone: "abion.test", Err: errors.Join(&internal.Error{Status: 400, Message: "invalid rdata"}, fmt.Errorf("%w: abion.test", ErrZoneConflict))},
+		}}, true},
+		{"permanent zone errors", &ApplyError{Zones: []*ZoneError{
+			{Zone: "a.test", Err: errors.Join(&internal.Error{Status: 400, Message: "invalid rdata"})},
+			{Zone: "b.test", Err: errors.Join(&internal.Error{Status: 403, Message: "Forbidden"})},
+		}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyError(tc.err)
+			assert.Equal(t, tc.soft, errors.Is(err, SoftError))
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.err.Error(), err.Error())
+		})
+	}
+}
+
+func Test_IsValidationError(t *testing.T) {
+	endpointErr := &EndpointError{Endpoint: &endpoint.Endpoint{DNSName: "www.abion.test", RecordType: "A"}, Err: ErrInvalidTarget}
+	testCases := []struct {
+		name       string
+		err        error
+		validation bool
+	}{
+		{"unmanaged record type", errors.Join(fmt.Errorf("%w MX of mail.abion.test", ErrUnmanagedRecordType)), true},
+		{"invalid dns name", fmt.Errorf("%w %q: invalid label", ErrInvalidDnsName, "a..b"), true},
+		{"apex cname", &ApplyError{Zones: []*ZoneError{{Zone: "abion.test", Err: errors.Join(fmt.Errorf("%w: abion.test", ErrApexCNAME))}}}, true},
+		{"rejected endpoints", &ApplyError{Zones: []*ZoneError{{Zone: "abion.test", Err: errors.Join(endpointErr, endpointErr)}}}, true},
+		{"rejected and failed zone", &ApplyError{Zones: []*ZoneError{
+			{Zone: "a.test", Err: errors.Join(endpointErr)},
+			{Zone: "b.test", Err: errors.Join(&internal.Error{Status: 400, Message: "Bad Request"})},
+		}}, false},
+		{"rejected endpoint and patch error", &ZoneError{Zone: "abion.test", Err: errors.Join(endpointErr, ErrZoneConflict)}, false},
+		{"rollback failed", &ZoneError{Zone: "abion.test", Err: fmt.Errorf("%w: %w", ErrRollback, endpointErr)}, false},
+		{"api error", &internal.Error{Status: 400, Message: "Bad Request"}, false},
+		{"soft error", NewSoftError(endpointErr), false},
+		{"nil", nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.validation, IsValidationError(tc.err))
+		})
+	}
+}
+
+func Test_ApplyChanges_ZoneError(t *testing.T) {
+	p := AbionProvider{
+		zoneFilter: []string{"abion.test"},
+		Client: &mockClient{
+			getZone: zoneResponse{err: &internal.Error{Status: 503, Message: "Service Unavailable"}},
+		},
+	}
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "www.abion.test", Targets: endpoint.Targets{"172.16.0.1"}, RecordType: "A"}},
+	})
+
+	var zoneErr *ZoneError
+	assert.ErrorAs(t, err, &zoneErr)
+	assert.Equal(t, "abion.test", zoneErr.Zone)
+	assert.ErrorIs(t, err, SoftError)
+}
+
+func Test_ApplyChanges_ApplyMode(t *testing.T) {
+	changes := func() *plan.Changes {
+		return &plan.Changes{
+			Create: []*endpoint.Endpoint{
+				{DNSName: "www.a.test", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A"},
+				{DNSName: "www.b.test", Targets: endpoint.Targets{"192.0.2.2"}, RecordType: "A"},
+			},
+			Delete: []*endpoint.Endpoint{
+				{DNSName: "old.b.test", Targets: endpoint.Targets{"192.0.2.3"}, RecordType: "A"},
+			},
+		}
+	}
+
+	testCases := []struct {
+		mode    string
+		patched []string
+	}{
+		{mode: ApplyModeFailFast},
+		{mode: ApplyModeBestEffort, patched: []string{"b.test", "b.test"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			client := &zonesClient{
+				mockClient: mockClient{
+					getZones: zonesResponse{
+						APIResponse: &internal.APIResponse[[]internal.Zone]{
+							Meta: &internal.Metadata{
+								Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+							},
+							Data: []internal.Zone{{ID: "a.test"}, {ID: "b.test"}},
+						},
+					},
+				},
+				zones: map[string]zoneResponse{
+					"a.test": {err: &internal.Error{Status: 403, Message: "Forbidden"}},
+					"b.test": {APIResponse: zoneWithRecords("b.test", map[string]map[string][]internal.Record{
+						"old": {"A": {{Data: "192.0.2.3"}}},
+					})},
+				},
+			}
+			p := AbionProvider{Client: client, applyMode: tc.mode}
+
+			failed := testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("a.test", zoneOutcomeFailed))
+			applied := testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("b.test", zoneOutcomeApplied))
+
+			err := p.ApplyChanges(context.Background(), changes())
+
+			var applyErr *ApplyError
+			if assert.ErrorAs(t, err, &applyErr) && assert.Len(t, applyErr.Zones, 1) {
+				assert.Equal(t, "a.test", applyErr.Zones[0].Zone)
+				assert.ErrorIs(t, applyErr.Zones[0], internal.ErrForbidden)
+			}
+			assert.EqualError(t, err, "changes of 1 zone(s) failed: zone a.test: api error: status=403, message=Forbidden")
+			assert.Equal(t, tc.patched, client.patched)
+
+			assert.Equal(t, failed+1, testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("a.test", zoneOutcomeFailed)))
+			assert.Equal(t, applied+float64(len(tc.patched)/2), testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("b.test", zoneOutcomeApplied)))
+		})
+	}
+}
+
+func Test_ApplyChanges_Transactional(t *testing.T) {
+	serverErr := &internal.Error{Status: 503, Message: "Service Unavailable"}
+	testCases := []struct {
+		name      string
+		patchErrs map[string][]error
+		outcome   string
+		errs      []error
+	}{
+		{
+			name:      "patches rolled back",
+			patchErrs: map[string][]error{"b.test": {serverErr}},
+			outcome:   zoneOutcomeRolledBack,
+			errs:      []error{internal.ErrServer},
+		},
+		{
+			name:      "rollback failed",
+			patchErrs: map[string][]error{"a.test": {nil, &internal.Error{Status: 400, Message: "Bad Request"}}, "b.test": {serverErr}},
+			outcome:   zoneOutcomeFailed,
+			errs:      []error{internal.ErrServer, ErrRollback, internal.ErrValidation},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &zonesClient{
+				mockClient: mockClient{
+					getZones: zonesResponse{
+						APIResponse: &internal.APIResponse[[]internal.Zone]{
+							Meta: &internal.Metadata{
+								Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+							},
+							Data: []internal.Zone{{ID: "a.test"}, {ID: "b.test"}},
+						},
+					},
+				},
+				zones: map[string]zoneResponse{
+					"a.test": {APIResponse: zoneWithRecords("a.test", map[string]map[string][]internal.Record{
+						"www": {"A": {{Data: "192.0.2.1", TTL: 300}}},
+					})},
+					"b.test": {APIResponse: zoneWithRecords("b.test", nil)},
+				},
+				patchErrs: tc.patchErrs,
+			}
+			p := AbionProvider{Client: client, applyMode: ApplyModeTransactional}
+
+			outcome := testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("a.test", tc.outcome))
+
+			err := p.ApplyChanges(context.Background(), &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					{DNSName: "api.a.test", Targets: endpoint.Targets{"192.0.2.2"}, RecordType: "A"},
+					{DNSName: "www.b.test", Targets: endpoint.Targets{"192.0.2.3"}, RecordType: "A"},
+				},
+				UpdateOld: []*endpoint.Endpoint{{DNSName: "www.a.test", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A", RecordTTL: 300}},
+				UpdateNew: []*endpoint.Endpoint{{DNSName: "www.a.test", Targets: endpoint.Targets{"192.0.2.9"}, RecordType: "A", RecordTTL: 300}},
+			})
+			for _, e := range tc.errs {
+				assert.ErrorIs(t, err, e)
+			}
+
+			// the update of a.test is not applied, the create of a.test is rolled back
+			assert.Equal(t, []string{"a.test", "b.test", "a.test"}, client.patched)
+			if assert.Len(t, client.records, 3) {
+				assert.Equal(t, map[string]map[string][]internal.Record{"api": {"A": nil}}, client.records[2])
+			}
+			assert.Equal(t, outcome+1, testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("a.test", tc.outcome)))
+		})
+	}
+}
+
+func Test_ApplyChanges_Transactional_Conflict(t *testing.T) {
+	client := &zonesClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+					},
+					Data: []internal.Zone{{ID: "a.test"}, {ID: "b.test"}},
+				},
+			},
+		},
+		zones: map[string]zoneResponse{
+			"a.test": {APIResponse: zoneWithRecords("a.test", nil)},
+			"b.test": {APIResponse: zoneWithRecords("b.test", nil)},
+		},
+		patchErrs: map[string][]error{"b.test": {&internal.Error{Status: 503, Message: "Service Unavailable"}}},
+		// another client adds a record to the patched record set of a.test
+		afterPatch: func(c *zonesClient, name string) {
+			if name == "a.test" {
+				c.apply(name, map[string]map[string][]internal.Record{
+					"www": {"A": {{Data: "192.0.2.1"}, {Data: "192.0.2.7"}}},
+				})
+			}
+		},
+	}
+	p := AbionProvider{Client: client, applyMode: ApplyModeTransactional}
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.a.test", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A"},
+			{DNSName: "www.b.test", Targets: endpoint.Targets{"192.0.2.2"}, RecordType: "A"},
+		},
+	})
+
+	// the record set changed by the other client is not overwritten
+	assert.ErrorIs(t, err, internal.ErrServer)
+	assert.ErrorIs(t, err, ErrRollback)
+	assert.ErrorIs(t, err, ErrZoneConflict)
+	assert.Equal(t, []string{"a.test", "b.test"}, client.patched)
+	assert.Equal(t, []internal.Record{{Data: "192.0.2.1"}, {Data: "192.0.2.7"}}, client.zones["a.test"].Data.Attributes.Records["www"]["A"])
+}
+
+func Test_ApplyChanges_Transactional_Normalized(t *testing.T) {
+	client := &zonesClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+					},
+					Data: []internal.Zone{{ID: "a.test"}, {ID: "b.test"}},
+				},
+			},
+		},
+		zones: map[string]zoneResponse{
+			"a.test": {APIResponse: zoneWithRecords("a.test", nil)},
+			"b.test": {APIResponse: zoneWithRecords("b.test", nil)},
+		},
+		patchErrs: map[string][]error{"b.test": {&internal.Error{Status: 503, Message: "Service Unavailable"}}},
+		// the API fills in the default TTL and a comment
+		normalize: func(r internal.Record) internal.Record {
+			if r.TTL == 0 {
+				r.TTL = 3600
+			}
+			if r.Comments == "" {
+				r.Comments = "created by api"
+			}
+			return r
+		},
+	}
+	p := AbionProvider{Client: client, applyMode: ApplyModeTransactional}
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.a.test", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A"},
+			{DNSName: "www.b.test", Targets: endpoint.Targets{"192.0.2.2"}, RecordType: "A"},
+		},
+	})
+
+	// the normalized records are not mistaken for a conflicting change
+	assert.ErrorIs(t, err, internal.ErrServer)
+	assert.NotErrorIs(t, err, ErrRollback)
+	assert.Equal(t, []string{"a.test", "b.test", "a.test"}, client.patched)
+	assert.Empty(t, client.zones["a.test"].Data.Attributes.Records["www"])
+}
+
+func Test_ApplyChanges_Transactional_Rejected(t *testing.T) {
+	client := &zonesClient{
+		mockClient: mockClient{
+			getZones: zonesResponse{
+				APIResponse: &internal.APIResponse[[]internal.Zone]{
+					Meta: &internal.Metadata{
+						Pagination: &internal.Pagination{Offset: 0, Limit: 2, Total: 2},
+					},
+					Data: []internal.Zone{{ID: "a.test"}, {ID: "b.test"}},
+				},
+			},
+		},
+		zones: map[string]zoneResponse{
+			"a.test": {APIResponse: zoneWithRecords("a.test", nil)},
+			"b.test": {APIResponse: zoneWithRecords("b.test", nil)},
+		},
+	}
+	p := AbionProvider{Client: client, applyMode: ApplyModeTransactional}
+
+	rolledBack := testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("a.test", zoneOutcomeRolledBack))
+	failed := testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("b.test", zoneOutcomeFailed))
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.a.test", Targets: endpoint.Targets{"192.0.2.1"}, RecordType: "A"},
+			{DNSName: "www.b.test", Targets: endpoint.Targets{"not-an-ip"}, RecordType: "A"},
+		},
+	})
+
+	// the rejected change of b.test rolls back the applied change of a.test
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+	assert.Equal(t, []string{"a.test", "a.test"}, client.patched)
+	if assert.Len(t, client.records, 2) {
+		assert.Equal(t, map[string]map[string][]internal.Record{"www": {"A": nil}}, client.records[1])
+	}
+	assert.Equal(t, rolledBack+1, testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("a.test", zoneOutcomeRolledBack)))
+	assert.Equal(t, failed+1, testutil.ToFloat64(metrics.ZoneApplies.WithLabelValues("b.test", zoneOutcomeFailed)))
+}
+
+func Test_ApplyChanges_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	p := AbionProvider{
+		zoneFilter: []string{"abion.test"},
+		Client: &mockClient{
+			getZone: zoneResponse{APIResponse: zoneWithRecords("abion.test", nil)},
+		},
+	}
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "www.abion.test", Targets: endpoint.Targets{"172.16.0.1"}, RecordType: "A"}},
+	})
+	assert.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	assert.Contains(t, spans, "AbionProvider.ApplyChanges")
+	assert.Contains(t, spans, "AbionProvider.processCreateActions")
+	assert.Contains(t, spans["AbionProvider.processCreateActions"].Attributes(), attribute.String(attributeZone, "abion.test"))
+	assert.Equal(t, spans["AbionProvider.ApplyChanges"].SpanContext().TraceID(), spans["AbionProvider.processCreateActions"].SpanContext().TraceID())
+}
@@ -0,0 +1,116 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+)
+
+// SoftError marks transient errors, mirroring the semantics of the external-dns
+// provider.SoftError: external-dns retries the changes in its next loop instead
+// of raising an error.
+var SoftError = errors.New("soft error")
+
+// ZoneError is an error of an operation on a single zone.
+type ZoneError struct {
+	Zone string
+	Err  error
+}
+
+func (e *ZoneError) Error() string {
+	return fmt.Sprintf("zone %s: %v", e.Zone, e.Err)
+}
+
+func (e *ZoneError) Unwrap() error {
+	return e.Err
+}
+
+type softError struct {
+	err error
+}
+
+// NewSoftError marks err as a transient error, see SoftError.
+func NewSoftError(err error) error {
+	return &softError{err: err}
+}
+
+func (e *softError) Error() string {
+	return e.err.Error()
+}
+
+func (e *softError) Unwrap() []error {
+	return []error{e.err, SoftError}
+}
+
+// classifyError marks transient errors as soft errors. These are rate limiting
+// and server errors of the Abion API, calls rejected by the open circuit
+// breaker, timeouts, transport errors and zones modified concurrently. All other
+// errors are permanent. An error joining several errors, e.g. an ApplyError, is
+// transient if any of them is: retrying the changes can still succeed.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, SoftError) {
+		return err
+	}
+	if isTransient(err) {
+		return NewSoftError(err)
+	}
+	return err
+}
+
+// isTransient classifies each error joined in err on its own, so a permanent
+// error of one zone does not hide a transient error of another.
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case interface{ Unwrap() []error }:
+		return slices.ContainsFunc(e.Unwrap(), isTransient)
+	case *internal.Error:
+		return errors.Is(e, internal.ErrRateLimited) || errors.Is(e, internal.ErrServer)
+	case *url.Error:
+		return true
+	case net.Error:
+		if e.Timeout() {
+			return true
+		}
+	}
+	if err == ErrZoneConflict || err == context.DeadlineExceeded || err == internal.ErrCircuitOpen {
+		return true
+	}
+	return isTransient(errors.Unwrap(err))
+}
+
+// IsValidationError returns true if err consists of changes rejected by the
+// provider before they are sent to the Abion API only: unmanaged record types,
+// invalid DNS names, apex CNAMEs and endpoints rejected by the pre-flight
+// validation. These errors are permanent, applying the same changes again fails
+// the same way. An ApplyError is a validation error if the errors of all zones are.
+func IsValidationError(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *EndpointError:
+		return true
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		if len(errs) == 0 {
+			return false
+		}
+		for _, err := range errs {
+			if !IsValidationError(err) {
+				return false
+			}
+		}
+		return true
+	}
+	// errors.Is would also match a single validation error joined with others
+	if err == ErrUnmanagedRecordType || err == ErrInvalidDnsName || err == ErrApexCNAME {
+		return true
+	}
+	return IsValidationError(errors.Unwrap(err))
+}
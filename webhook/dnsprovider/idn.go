@@ -0,0 +1,88 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/idna"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ErrInvalidDnsName is returned for DNS names that cannot be converted to A-labels.
+var ErrInvalidDnsName = errors.New("invalid DNS name")
+
+// idnaProfile converts internationalized domain names for lookup, but allows
+// the `*` and `_` characters of wildcard and service labels.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.BidiRule())
+
+// toASCII converts a DNS name to its A-label (punycode) form, e.g.
+// bücher.example -> xn--bcher-kva.example.
+func toASCII(name string) (string, error) {
+	ascii, err := idnaProfile.ToASCII(unescapeWildcard(name))
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidDnsName, name, err)
+	}
+	return ascii, nil
+}
+
+// asciiName converts a DNS name to A-labels for comparisons. Invalid names are
+// returned unchanged, they are reported by checkDnsNames.
+func asciiName(name string) string {
+	ascii, err := toASCII(name)
+	if err != nil {
+		return unescapeWildcard(name)
+	}
+	return ascii
+}
+
+// displayName returns the name for log messages, with its Unicode form if it
+// contains A-labels, e.g. `xn--bcher-kva.example (bücher.example)`.
+func displayName(name string) string {
+	unicode, err := idnaProfile.ToUnicode(name)
+	if err != nil || unicode == name {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, unicode)
+}
+
+// checkDnsNames returns an error for every endpoint with a DNS name or CNAME
+// target that is not a valid (internationalized) domain name.
+func checkDnsNames(endpoints []*endpoint.Endpoint) error {
+	var errs []error
+	for _, ep := range endpoints {
+		if _, err := toASCII(ep.DNSName); err != nil {
+			errs = append(errs, err)
+		}
+		if ep.RecordType != endpoint.RecordTypeCNAME {
+			continue
+		}
+		for _, target := range ep.Targets {
+			if _, err := toASCII(target); err != nil {
+				errs = append(errs, fmt.Errorf("CNAME target of %s: %w", ep.DNSName, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// toASCIIEndpoints converts the DNS names and CNAME targets of the endpoints to
+// A-labels. Invalid names are kept as they are.
+func toASCIIEndpoints(ctx context.Context, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	for _, ep := range endpoints {
+		if ascii, err := toASCII(ep.DNSName); err == nil && ascii != ep.DNSName {
+			log.WithContext(ctx).Debugf("Converted DNS name %s to %s", ep.DNSName, displayName(ascii))
+			ep.DNSName = ascii
+		}
+		if ep.RecordType != endpoint.RecordTypeCNAME {
+			continue
+		}
+		for i, target := range ep.Targets {
+			if ascii, err := toASCII(target); err == nil {
+				ep.Targets[i] = ascii
+			}
+		}
+	}
+	return endpoints
+}
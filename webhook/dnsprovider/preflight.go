@@ -0,0 +1,263 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+var (
+	// ErrCNAMEConflict is returned for CNAME records sharing a name with other records.
+	ErrCNAMEConflict = errors.New("CNAME record conflicts with other records on the same name")
+	// ErrDuplicateTarget is returned for targets of a record set given more than once.
+	ErrDuplicateTarget = errors.New("duplicate target")
+	// ErrInvalidTarget is returned for targets that are not valid data of the record type.
+	ErrInvalidTarget = errors.New("invalid target")
+)
+
+// EndpointError is a created or updated endpoint rejected by the pre-flight
+// validation, with the record or endpoint it conflicts with, if any.
+type EndpointError struct {
+	Endpoint *endpoint.Endpoint
+	Conflict string
+	Err      error
+}
+
+func (e *EndpointError) Error() string {
+	msg := fmt.Sprintf("%s %s %s: %v", e.Endpoint.DNSName, e.Endpoint.RecordType, redactTargets(e.Endpoint.RecordType, e.Endpoint.Targets), e.Err)
+	if e.Conflict != "" {
+		msg += ", conflicts with " + e.Conflict
+	}
+	return msg
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// preflight validates the changed endpoints of a zone against the zone records
+// read under the zone lock, excluding the removed endpoints. The planned
+// endpoints are changed by a later patch of the zone, they are validated to
+// detect conflicts with the changed endpoints but are not rejected. It returns
+// the accepted endpoints and an EndpointError for every rejected endpoint, so
+// the accepted changes of the zone are still applied.
+func (p *AbionProvider) preflight(ctx context.Context, zoneId string, records map[string]map[string][]internal.Record, changed, planned, removed []*endpoint.Endpoint) ([]*endpoint.Endpoint, []error) {
+	v := p.newZoneValidator(zoneId, records, removed)
+
+	accepted := slices.Clone(changed)
+	var rejected []error
+	for _, e := range v.validate(slices.Concat(changed, planned)) {
+		if !slices.Contains(changed, e.Endpoint) {
+			continue
+		}
+		log.WithContext(ctx).Warnf("Rejecting change of zone %s: %v", zoneId, e)
+		accepted = slices.DeleteFunc(accepted, func(ep *endpoint.Endpoint) bool { return ep == e.Endpoint })
+		rejected = append(rejected, e)
+	}
+	return accepted, rejected
+}
+
+// rejections returns the errors of the rejected endpoints if err consists of
+// EndpointErrors only.
+func rejections(err error) ([]error, bool) {
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	for _, e := range errs {
+		if _, ok := e.(*EndpointError); !ok {
+			return nil, false
+		}
+	}
+	return errs, true
+}
+
+// zoneValidator validates endpoints against the records of a zone, excluding
+// the records removed by the changes.
+type zoneValidator struct {
+	p      *AbionProvider
+	zoneId string
+	// current holds the remaining record data by name and type.
+	current map[string]map[string][]string
+	// pending holds the endpoints accepted so far by name.
+	pending map[string][]*endpoint.Endpoint
+}
+
+func (p *AbionProvider) newZoneValidator(zoneId string, records map[string]map[string][]internal.Record, removed []*endpoint.Endpoint) *zoneValidator {
+	v := &zoneValidator{
+		p:       p,
+		zoneId:  zoneId,
+		current: make(map[string]map[string][]string, len(records)),
+		pending: make(map[string][]*endpoint.Endpoint),
+	}
+	for name, recordTypes := range records {
+		v.current[name] = make(map[string][]string, len(recordTypes))
+		for recordType, recs := range recordTypes {
+			for _, r := range recs {
+				v.current[name][recordType] = append(v.current[name][recordType], r.Data)
+			}
+		}
+	}
+	for _, ep := range removed {
+		name := p.getAbionDnsName(ep.DNSName, zoneId)
+		if v.current[name] == nil {
+			continue
+		}
+		targets := v.targets(ep)
+		v.current[name][ep.RecordType] = slices.DeleteFunc(v.current[name][ep.RecordType], func(data string) bool {
+			return slices.Contains(targets, data)
+		})
+	}
+	return v
+}
+
+func (v *zoneValidator) targets(ep *endpoint.Endpoint) []string {
+	targets := make([]string, 0, len(ep.Targets))
+	for _, target := range ep.Targets {
+		targets = append(targets, v.p.formatTarget(ep, target))
+	}
+	return targets
+}
+
+// validate returns an error for every rejected endpoint. CNAME endpoints are
+// validated last, so a CNAME conflicting with another changed endpoint is
+// rejected instead of the other endpoint.
+func (v *zoneValidator) validate(endpoints []*endpoint.Endpoint) []*EndpointError {
+	ordered := slices.Clone(endpoints)
+	slices.SortStableFunc(ordered, func(a, b *endpoint.Endpoint) int {
+		return compareBool(a.RecordType == endpoint.RecordTypeCNAME, b.RecordType == endpoint.RecordTypeCNAME)
+	})
+
+	var rejected []*EndpointError
+	for _, ep := range ordered {
+		if err := v.check(ep); err != nil {
+			rejected = append(rejected, err)
+			continue
+		}
+		name := v.p.getAbionDnsName(ep.DNSName, v.zoneId)
+		v.pending[name] = append(v.pending[name], ep)
+	}
+	return rejected
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func (v *zoneValidator) check(ep *endpoint.Endpoint) *EndpointError {
+	name := v.p.getAbionDnsName(ep.DNSName, v.zoneId)
+	targets := v.targets(ep)
+
+	if _, err := v.p.recordComment(ep); err != nil {
+		return &EndpointError{Endpoint: ep, Err: err}
+	}
+	for i, target := range targets {
+		if err := validateTarget(ep.RecordType, target); err != nil {
+			return &EndpointError{Endpoint: ep, Err: err}
+		}
+		if slices.Contains(targets[:i], target) {
+			return &EndpointError{Endpoint: ep, Err: fmt.Errorf("%w %s", ErrDuplicateTarget, redactTarget(ep.RecordType, target))}
+		}
+		if slices.Contains(v.current[name][ep.RecordType], target) {
+			return &EndpointError{Endpoint: ep, Err: fmt.Errorf("%w %s", ErrDuplicateTarget, redactTarget(ep.RecordType, target)), Conflict: v.existing(name, ep.RecordType)}
+		}
+	}
+	for _, other := range v.pending[name] {
+		if other.RecordType == ep.RecordType && other.SetIdentifier == ep.SetIdentifier {
+			return &EndpointError{Endpoint: ep, Err: fmt.Errorf("%w, record set changed twice", ErrDuplicateTarget), Conflict: describeEndpoint(other)}
+		}
+	}
+
+	if ep.RecordType == endpoint.RecordTypeCNAME {
+		if len(targets) > 1 {
+			return &EndpointError{Endpoint: ep, Err: fmt.Errorf("%w: CNAME record with %d targets", ErrCNAMEConflict, len(targets))}
+		}
+		var conflicts []string
+		for _, recordType := range slices.Sorted(maps.Keys(v.current[name])) {
+			if len(v.current[name][recordType]) > 0 {
+				conflicts = append(conflicts, v.existing(name, recordType))
+			}
+		}
+		for _, other := range v.pending[name] {
+			conflicts = append(conflicts, describeEndpoint(other))
+		}
+		if len(conflicts) > 0 {
+			return &EndpointError{Endpoint: ep, Err: ErrCNAMEConflict, Conflict: strings.Join(conflicts, "; ")}
+		}
+		return nil
+	}
+
+	if len(v.current[name][endpoint.RecordTypeCNAME]) > 0 {
+		return &EndpointError{Endpoint: ep, Err: ErrCNAMEConflict, Conflict: v.existing(name, endpoint.RecordTypeCNAME)}
+	}
+	return nil
+}
+
+// existing describes the remaining records of a record set of the zone.
+func (v *zoneValidator) existing(name, recordType string) string {
+	return fmt.Sprintf("existing record %s %s %s", v.p.getExternalDnsDnsName(name, v.zoneId), recordType, redactTargets(recordType, v.current[name][recordType]))
+}
+
+func describeEndpoint(ep *endpoint.Endpoint) string {
+	return fmt.Sprintf("endpoint %s %s %s", ep.DNSName, ep.RecordType, redactTargets(ep.RecordType, ep.Targets))
+}
+
+// validateTarget checks the data of A, AAAA, CNAME, ALIAS, MX and SRV records.
+// The data of other record types is left to the Abion API.
+func validateTarget(recordType, target string) error {
+	if target == "" {
+		return fmt.Errorf("%w: empty %s target", ErrInvalidTarget, recordType)
+	}
+
+	switch recordType {
+	case endpoint.RecordTypeA:
+		if ip := net.ParseIP(target); ip == nil || ip.To4() == nil || strings.Contains(target, ":") {
+			return fmt.Errorf("%w %q: not an IPv4 address", ErrInvalidTarget, target)
+		}
+	case endpoint.RecordTypeAAAA:
+		if ip := net.ParseIP(target); ip == nil || !strings.Contains(target, ":") {
+			return fmt.Errorf("%w %q: not an IPv6 address", ErrInvalidTarget, target)
+		}
+	case endpoint.RecordTypeCNAME, aliasRecordType:
+		if net.ParseIP(strings.TrimSuffix(target, ".")) != nil {
+			return fmt.Errorf("%w %q: not a host name", ErrInvalidTarget, target)
+		}
+		if _, err := toASCII(target); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+		}
+	case endpoint.RecordTypeMX:
+		fields := strings.Fields(target)
+		if len(fields) != 2 || !isUint16(fields[0]) {
+			return fmt.Errorf("%w %q: expected <preference> <exchange>", ErrInvalidTarget, target)
+		}
+	case endpoint.RecordTypeSRV:
+		fields := strings.Fields(target)
+		if len(fields) != 4 || !isUint16(fields[0]) || !isUint16(fields[1]) || !isUint16(fields[2]) {
+			return fmt.Errorf("%w %q: expected <priority> <weight> <port> <target>", ErrInvalidTarget, target)
+		}
+	}
+	return nil
+}
+
+func isUint16(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
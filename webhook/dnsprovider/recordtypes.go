@@ -0,0 +1,63 @@
+package dnsprovider
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// ErrUnmanagedRecordType is returned for changes of record types not included
+// in the managed record types.
+var ErrUnmanagedRecordType = errors.New("unmanaged record type")
+
+// recordTypeFilter is the set of record types managed by the provider. A nil
+// filter manages all record types.
+type recordTypeFilter map[string]struct{}
+
+func newRecordTypeFilter(recordTypes []string) recordTypeFilter {
+	var f recordTypeFilter
+	for _, t := range recordTypes {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t == "" {
+			continue
+		}
+		if f == nil {
+			f = make(recordTypeFilter)
+		}
+		f[t] = struct{}{}
+	}
+	return f
+}
+
+// managed returns true if records of the type are managed by the provider.
+func (f recordTypeFilter) managed(recordType string) bool {
+	if f == nil {
+		return true
+	}
+	_, ok := f[strings.ToUpper(recordType)]
+	return ok
+}
+
+// check returns an error for every change of an unmanaged record type.
+func (f recordTypeFilter) check(changes *plan.Changes) error {
+	var errs []error
+	for _, ep := range slices.Concat(changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete) {
+		if !f.managed(ep.RecordType) {
+			errs = append(errs, fmt.Errorf("%w %s of %s", ErrUnmanagedRecordType, ep.RecordType, ep.DNSName))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// filter returns the endpoints of managed record types.
+func (f recordTypeFilter) filter(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if f == nil {
+		return endpoints
+	}
+	return slices.DeleteFunc(endpoints, func(ep *endpoint.Endpoint) bool {
+		return !f.managed(ep.RecordType)
+	})
+}
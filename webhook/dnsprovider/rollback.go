@@ -0,0 +1,135 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/audit"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrRollback is returned for zones whose patches could not be rolled back.
+var ErrRollback = errors.New("rollback failed")
+
+type patchJournalKey struct{}
+
+// patchJournal keeps the record sets of the zones patched by a transactional
+// ApplyChanges call as they were before the first patch of the call, and as
+// they were after the last one.
+type patchJournal struct {
+	zones  []string
+	before map[string]map[string]map[string][]internal.Record
+	after  map[string]map[string]map[string][]internal.Record
+}
+
+func newPatchJournal() *patchJournal {
+	return &patchJournal{
+		before: make(map[string]map[string]map[string][]internal.Record),
+		after:  make(map[string]map[string]map[string][]internal.Record),
+	}
+}
+
+// withPatchJournal returns a copy of ctx recording the applied patches in j.
+func withPatchJournal(ctx context.Context, j *patchJournal) context.Context {
+	return context.WithValue(ctx, patchJournalKey{}, j)
+}
+
+// patchJournalFromContext returns the patch journal of ctx, or nil if the
+// patches are not recorded.
+func patchJournalFromContext(ctx context.Context) *patchJournal {
+	j, _ := ctx.Value(patchJournalKey{}).(*patchJournal)
+	return j
+}
+
+// record adds an applied patch of the zone with the zone records it was
+// applied to and the patched record sets as returned by the Abion API, which
+// the rollback expects to find unmodified. Record sets that did not exist
+// before are restored as empty.
+func (j *patchJournal) record(zoneId string, current, records map[string]map[string][]internal.Record) {
+	if j == nil {
+		return
+	}
+	before, ok := j.before[zoneId]
+	if !ok {
+		before = make(map[string]map[string][]internal.Record)
+		j.before[zoneId] = before
+		j.after[zoneId] = make(map[string]map[string][]internal.Record)
+		j.zones = append(j.zones, zoneId)
+	}
+	after := j.after[zoneId]
+
+	for name, recordTypes := range records {
+		if before[name] == nil {
+			before[name] = make(map[string][]internal.Record)
+			after[name] = make(map[string][]internal.Record)
+		}
+		for recordType, recs := range recordTypes {
+			if _, ok := before[name][recordType]; !ok {
+				before[name][recordType] = slices.Clone(current[name][recordType])
+			}
+			after[name][recordType] = recs
+		}
+	}
+}
+
+// rollback restores the record sets of every patched zone in reverse patch
+// order. The errors of the zones that could not be restored are recorded in
+// the results.
+func (p *AbionProvider) rollback(ctx context.Context, j *patchJournal, results *applyResults) {
+	// the rollback must not be canceled with the request that failed
+	ctx = context.WithoutCancel(ctx)
+
+	for _, zoneId := range slices.Backward(j.zones) {
+		log.WithContext(ctx).Warnf("Rolling back changes of zone %s", zoneId)
+		if err := p.rollbackZone(ctx, zoneId, j.after[zoneId], j.before[zoneId]); err != nil {
+			log.WithContext(ctx).Errorf("unable to roll back changes of zone %s: %v", zoneId, err)
+			results.fail(zoneId, fmt.Errorf("%w: %w", ErrRollback, err))
+			continue
+		}
+		results.rolledBack(zoneId)
+	}
+}
+
+// rollbackZone patches the zone with the record sets as they were before the
+// first patch, the zone lock is held by applyChanges. The zone is re-read first, if the
+// record sets were changed by others after the last patch, they are not
+// overwritten and ErrZoneConflict is returned.
+func (p *AbionProvider) rollbackZone(ctx context.Context, zoneId string, current, records map[string]map[string][]internal.Record) error {
+	entry := audit.Entry{
+		RequestID: internal.RequestIDFromContext(ctx),
+		Zone:      zoneId,
+		Rollback:  true,
+		Changes:   audit.Changes(current, records),
+	}
+
+	if err := p.checkZoneUnmodified(ctx, zoneId, current, records); err != nil {
+		entry.Outcome = audit.OutcomeFailed
+		entry.Error = err.Error()
+		p.auditLog.Log(entry)
+		return err
+	}
+
+	patchRequest := internal.ZoneRequest{
+		Data: internal.Zone{
+			Type: "zone",
+			ID:   zoneId,
+			Attributes: internal.Attributes{
+				Records: records,
+			},
+		},
+	}
+
+	if _, err := p.Client.PatchZone(ctx, zoneId, patchRequest); err != nil {
+		entry.Outcome = audit.OutcomeFailed
+		entry.Error = err.Error()
+		p.auditLog.Log(entry)
+		return err
+	}
+
+	entry.Outcome = audit.OutcomeApplied
+	p.auditLog.Log(entry)
+	return nil
+}
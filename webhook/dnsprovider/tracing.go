@@ -0,0 +1,38 @@
+package dnsprovider
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	attributeZone      = "abion.zone"
+	attributeZones     = "abion.zones"
+	attributeEndpoints = "abion.endpoints"
+)
+
+var tracer = otel.Tracer("github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider")
+
+// traceZone runs fn for a single zone within its own span.
+func traceZone(ctx context.Context, name string, zoneId string, endpoints int, fn func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String(attributeZone, zoneId),
+		attribute.Int(attributeEndpoints, endpoints),
+	))
+	err := fn(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
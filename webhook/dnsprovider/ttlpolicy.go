@@ -0,0 +1,182 @@
+package dnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/metrics"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	ttlBoundMin = "min"
+	ttlBoundMax = "max"
+	// ttlDefault is the key of the default TTL in TTL overrides
+	ttlDefault = "default"
+)
+
+// ttlLimits holds the minimum, maximum and default TTL in seconds. Zero values
+// are not set.
+type ttlLimits struct {
+	Min     int
+	Max     int
+	Default int
+}
+
+// merge returns the limits with the values set in override replaced.
+func (l ttlLimits) merge(override ttlLimits) ttlLimits {
+	if override.Min != 0 {
+		l.Min = override.Min
+	}
+	if override.Max != 0 {
+		l.Max = override.Max
+	}
+	if override.Default != 0 {
+		l.Default = override.Default
+	}
+	return l
+}
+
+func (l ttlLimits) validate() error {
+	if l.Min < 0 || l.Max < 0 || l.Default < 0 {
+		return fmt.Errorf("TTL values must not be negative")
+	}
+	if l.Min != 0 && l.Max != 0 && l.Min > l.Max {
+		return fmt.Errorf("minimum TTL %d is greater than maximum TTL %d", l.Min, l.Max)
+	}
+	return nil
+}
+
+// ttlPolicy sets the default TTL of records without TTL and clamps TTLs to the
+// minimum and maximum TTL. The global limits can be overridden for zones, e.g.
+// example.com, or zone patterns, e.g. *.example.com. Overrides are matched
+// against the DNS names of the records, the most specific override wins. A nil
+// ttlPolicy leaves all TTLs unchanged.
+type ttlPolicy struct {
+	global    ttlLimits
+	overrides map[string]ttlLimits
+}
+
+// newTTLPolicy creates the TTL policy from the global limits and the overrides,
+// given as `<zone or pattern>=min:<ttl>,max:<ttl>,default:<ttl>`. It returns
+// nil if no limits are set.
+func newTTLPolicy(global ttlLimits, overrides []string) (*ttlPolicy, error) {
+	if err := global.validate(); err != nil {
+		return nil, fmt.Errorf("invalid TTL policy: %w", err)
+	}
+
+	p := &ttlPolicy{global: global, overrides: make(map[string]ttlLimits)}
+	for _, override := range overrides {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		pattern, limits, err := parseTTLOverride(override)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TTL override %q: %w", override, err)
+		}
+		if err := global.merge(limits).validate(); err != nil {
+			return nil, fmt.Errorf("invalid TTL override %q: %w", override, err)
+		}
+		p.overrides[pattern] = limits
+	}
+
+	if p.global == (ttlLimits{}) && len(p.overrides) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func parseTTLOverride(override string) (string, ttlLimits, error) {
+	var limits ttlLimits
+	pattern, values, ok := strings.Cut(override, "=")
+	pattern = NormalizeDnsName(pattern)
+	if !ok || pattern == "" {
+		return "", limits, fmt.Errorf("expected <zone>=min:<ttl>,max:<ttl>,default:<ttl>")
+	}
+
+	for _, value := range strings.Split(values, ",") {
+		key, ttl, ok := strings.Cut(strings.TrimSpace(value), ":")
+		if !ok {
+			return "", limits, fmt.Errorf("%q should be in \"key:ttl\" format", value)
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(ttl))
+		if err != nil {
+			return "", limits, fmt.Errorf("invalid TTL %q: %w", ttl, err)
+		}
+		switch strings.TrimSpace(key) {
+		case ttlBoundMin:
+			limits.Min = seconds
+		case ttlBoundMax:
+			limits.Max = seconds
+		case ttlDefault:
+			limits.Default = seconds
+		default:
+			return "", limits, fmt.Errorf("unknown key %q, expected min, max or default", key)
+		}
+	}
+	return pattern, limits, nil
+}
+
+// limits returns the TTL limits for the DNS name. An override for a zone
+// applies to the zone and all names below it, an override for a pattern
+// *.example.com to all names below example.com. The override of the longest
+// matching name wins: below example.com a *.example.com pattern takes
+// precedence over an example.com override, which still applies to example.com
+// itself.
+func (p *ttlPolicy) limits(dnsName string) ttlLimits {
+	name := NormalizeDnsName(dnsName)
+	for suffix := name; ; {
+		// the pattern of the parent name matches names below it, but not the parent itself
+		if limits, ok := p.overrides[wildcardLabel+"."+suffix]; ok && suffix != name {
+			return p.global.merge(limits)
+		}
+		if limits, ok := p.overrides[suffix]; ok {
+			return p.global.merge(limits)
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			return p.global
+		}
+		suffix = suffix[i+1:]
+	}
+}
+
+// apply sets the default TTL of the endpoint if it has none and clamps its TTL
+// to the minimum and maximum TTL.
+func (p *ttlPolicy) apply(ctx context.Context, ep *endpoint.Endpoint) {
+	if p == nil {
+		return
+	}
+	limits := p.limits(ep.DNSName)
+
+	if !ep.RecordTTL.IsConfigured() {
+		if limits.Default == 0 {
+			return
+		}
+		ep.RecordTTL = endpoint.TTL(limits.Default)
+	}
+
+	ttl := int(ep.RecordTTL)
+	switch {
+	case limits.Min != 0 && ttl < limits.Min:
+		p.clamp(ctx, ep, limits.Min, ttlBoundMin)
+	case limits.Max != 0 && ttl > limits.Max:
+		p.clamp(ctx, ep, limits.Max, ttlBoundMax)
+	}
+}
+
+// applyAll applies the policy to all endpoints.
+func (p *ttlPolicy) applyAll(ctx context.Context, endpoints []*endpoint.Endpoint) {
+	for _, ep := range endpoints {
+		p.apply(ctx, ep)
+	}
+}
+
+func (p *ttlPolicy) clamp(ctx context.Context, ep *endpoint.Endpoint, ttl int, bound string) {
+	log.WithContext(ctx).Warnf("Clamping TTL of %s %s from %d to %s TTL %d", ep.DNSName, ep.RecordType, ep.RecordTTL, bound, ttl)
+	metrics.TTLClamped.WithLabelValues(ep.RecordType, bound).Inc()
+	ep.RecordTTL = endpoint.TTL(ttl)
+}
@@ -0,0 +1,54 @@
+package dnsprovider
+
+import (
+	"strings"
+)
+
+const (
+	// wildcardLabel is the leftmost label of wildcard records, e.g. *.apps.example.com.
+	wildcardLabel = "*"
+	// escapedWildcardLabel is the wildcard label in the escaped form used by
+	// some external-dns sources.
+	escapedWildcardLabel = `\052`
+)
+
+// unescapeWildcard replaces an escaped leading wildcard label by `*`.
+func unescapeWildcard(name string) string {
+	if rest, ok := strings.CutPrefix(name, escapedWildcardLabel); ok && (rest == "" || rest[0] == '.') {
+		return wildcardLabel + rest
+	}
+	return name
+}
+
+// parseZoneFilter splits a zone filter entry into the zone name and whether it
+// matches the subdomains of the zone, e.g. *.example.com -> example.com, true.
+func parseZoneFilter(filter string) (zone string, wildcard bool) {
+	filter = NormalizeDnsName(filter)
+	if rest, ok := strings.CutPrefix(filter, wildcardLabel+"."); ok {
+		return rest, true
+	}
+	return filter, false
+}
+
+// matchesZoneFilterEntry returns true if the zone matches the zone filter entry.
+// A wildcard entry *.example.com matches every subdomain of example.com but not
+// example.com itself.
+func matchesZoneFilterEntry(filter string, zone string) bool {
+	name, wildcard := parseZoneFilter(filter)
+	zone = NormalizeDnsName(zone)
+	if !wildcard {
+		return zone == name
+	}
+	return strings.HasSuffix(zone, "."+name)
+}
+
+// domainFilterEntry returns the external-dns domain filter entry for a zone
+// filter entry. Wildcard entries become .example.com, which external-dns
+// matches against the subdomains of example.com only.
+func domainFilterEntry(filter string) string {
+	name, wildcard := parseZoneFilter(filter)
+	if wildcard {
+		return "." + name
+	}
+	return name
+}
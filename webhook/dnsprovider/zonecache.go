@@ -0,0 +1,54 @@
+package dnsprovider
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// zoneCache caches the managed zone IDs for a configured duration. A nil
+// zoneCache or a zero TTL disables caching.
+type zoneCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	zoneIDs []string
+	expires time.Time
+}
+
+func newZoneCache(ttl time.Duration) *zoneCache {
+	return &zoneCache{ttl: ttl}
+}
+
+func (c *zoneCache) get() ([]string, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zoneIDs == nil || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return slices.Clone(c.zoneIDs), true
+}
+
+func (c *zoneCache) set(zoneIDs []string) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.zoneIDs = slices.Clone(zoneIDs)
+	if c.zoneIDs == nil {
+		c.zoneIDs = []string{}
+	}
+	c.expires = time.Now().Add(c.ttl)
+}
+
+func (c *zoneCache) flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.zoneIDs = nil
+}
@@ -0,0 +1,97 @@
+package dnsprovider
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+)
+
+// ErrZoneConflict is returned when a zone was modified by someone else between
+// reading it and patching it. external-dns retries the changes in its next loop.
+var ErrZoneConflict = errors.New("zone was modified concurrently")
+
+// zoneLocker serializes changes to the same zone within this webhook instance.
+// The zones changed by an ApplyChanges call are locked for the whole call, so
+// the create, update and delete phases and the rollback of concurrent calls
+// don't interleave. A nil zoneLocker doesn't lock.
+type zoneLocker struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newZoneLocker() *zoneLocker {
+	return &zoneLocker{locks: make(map[string]*sync.Mutex)}
+}
+
+// lock acquires the locks of the zones and returns the function releasing
+// them. The locks are acquired in sorted order, so concurrent calls locking
+// several zones don't deadlock.
+func (l *zoneLocker) lock(zoneIds ...string) func() {
+	if l == nil {
+		return func() {}
+	}
+
+	keys := make([]string, 0, len(zoneIds))
+	for _, zoneId := range zoneIds {
+		keys = append(keys, strings.ToLower(strings.TrimSuffix(zoneId, ".")))
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	zoneLocks := make([]*sync.Mutex, 0, len(keys))
+	l.mu.Lock()
+	for _, key := range keys {
+		zoneLock, ok := l.locks[key]
+		if !ok {
+			zoneLock = &sync.Mutex{}
+			l.locks[key] = zoneLock
+		}
+		zoneLocks = append(zoneLocks, zoneLock)
+	}
+	l.mu.Unlock()
+
+	for _, zoneLock := range zoneLocks {
+		zoneLock.Lock()
+	}
+	return func() {
+		for _, zoneLock := range slices.Backward(zoneLocks) {
+			zoneLock.Unlock()
+		}
+	}
+}
+
+// changedRecordSets returns the "name/type" keys of the patched record sets
+// whose records differ between the read and the re-fetched zone records.
+func changedRecordSets(read, refetched, patch map[string]map[string][]internal.Record) []string {
+	var changed []string
+	for name, recordTypes := range patch {
+		for recordType := range recordTypes {
+			if !sameRecords(read[name][recordType], refetched[name][recordType]) {
+				changed = append(changed, name+"/"+recordType)
+			}
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+func sameRecords(a, b []internal.Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	compare := func(x, y internal.Record) int {
+		if c := strings.Compare(x.Data, y.Data); c != 0 {
+			return c
+		}
+		if x.TTL != y.TTL {
+			return x.TTL - y.TTL
+		}
+		return strings.Compare(x.Comments, y.Comments)
+	}
+	a = slices.SortedFunc(slices.Values(a), compare)
+	b = slices.SortedFunc(slices.Values(b), compare)
+	return slices.Equal(a, b)
+}
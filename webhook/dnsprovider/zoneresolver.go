@@ -0,0 +1,66 @@
+package dnsprovider
+
+import (
+	"strings"
+)
+
+// zoneResolver maps DNS names to the managed zone they belong to. With nested
+// zones, e.g. example.com and dev.example.com, the zone with the longest
+// matching suffix wins. Names are matched case-insensitively on label
+// boundaries, so notexample.com never matches example.com, internationalized
+// names are matched by their A-labels and trailing dots are ignored.
+type zoneResolver struct {
+	// zones maps the normalized zone name to the zone ID
+	zones map[string]string
+}
+
+func newZoneResolver(zoneIDs []string) *zoneResolver {
+	r := &zoneResolver{zones: make(map[string]string, len(zoneIDs))}
+	for _, zoneID := range zoneIDs {
+		if name := NormalizeDnsName(zoneID); name != "" {
+			r.zones[name] = zoneID
+		}
+	}
+	return r
+}
+
+// Resolve returns the ID of the most specific zone containing dnsName and the
+// name relative to that zone, "@" for the zone apex. ok is false if no managed
+// zone contains dnsName.
+func (r *zoneResolver) Resolve(dnsName string) (zoneID string, label string, ok bool) {
+	name := NormalizeDnsName(dnsName)
+	if name == "" {
+		return "", "", false
+	}
+
+	// walk the suffixes from the full name to the TLD, the first match is the longest
+	for suffix := name; ; {
+		if zoneID, ok := r.zones[suffix]; ok {
+			return zoneID, relativeName(name, suffix), true
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			return "", "", false
+		}
+		suffix = suffix[i+1:]
+	}
+}
+
+// NormalizeDnsName lowercases the name, converts it to A-labels and removes
+// surrounding whitespace and the trailing dot of fully qualified names. An
+// escaped wildcard label is replaced by `*`.
+func NormalizeDnsName(name string) string {
+	return asciiName(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), "."))
+}
+
+// relativeName returns dnsName relative to the zone, "@" for the zone apex.
+// Both names must be normalized. A name outside the zone is returned as is.
+func relativeName(dnsName, zone string) string {
+	if dnsName == zone {
+		return "@"
+	}
+	if strings.HasSuffix(dnsName, "."+zone) {
+		return dnsName[:len(dnsName)-len(zone)-1]
+	}
+	return dnsName
+}
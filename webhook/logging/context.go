@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	log "github.com/sirupsen/logrus"
+)
+
+// FieldRequestID is the log field holding the webhook request ID.
+const FieldRequestID = "requestId"
+
+// requestIDHook adds the request ID of the entry context to every log entry
+// created with log.WithContext.
+type requestIDHook struct{}
+
+func (h *requestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *requestIDHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if _, ok := entry.Data[FieldRequestID]; ok {
+		return nil
+	}
+	if requestID := internal.RequestIDFromContext(entry.Context); requestID != "" {
+		entry.Data[FieldRequestID] = requestID
+	}
+	return nil
+}
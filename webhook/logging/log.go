@@ -1,13 +1,30 @@
 package logging
 
 import (
+	"sync"
+
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
 	log "github.com/sirupsen/logrus"
 )
 
+var addHooks sync.Once
+
 func Init(config *configuration.Configuration) {
 	setLogLevel(config.Debug)
 	setLogFormat(config.LogFormat)
+	setRedactor(config)
+	addHooks.Do(func() {
+		log.AddHook(&requestIDHook{})
+		log.AddHook(&redactHook{})
+	})
+}
+
+func setRedactor(config *configuration.Configuration) {
+	r, err := NewRedactor([]string{config.ApiKey}, config.LogRedactTXTPatterns)
+	if err != nil {
+		log.Fatalf("Error reading configuration from environment: %v", err)
+	}
+	redactor = r
 }
 
 func setLogLevel(debugEnabled bool) {
@@ -27,3 +44,19 @@ func setLogFormat(logFormat string) {
 		log.SetFormatter(&log.TextFormatter{})
 	}
 }
+
+// Level returns the current log level.
+func Level() string {
+	return log.GetLevel().String()
+}
+
+// SetLevel changes the log level at runtime, e.g. to `debug` or `info`.
+func SetLevel(level string) error {
+	logLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(logLevel)
+	log.Infof("log level changed to %s", logLevel)
+	return nil
+}
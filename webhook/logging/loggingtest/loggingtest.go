@@ -0,0 +1,36 @@
+// Package loggingtest provides a helper to test the log output of the webhook.
+package loggingtest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
+	"github.com/caarlos0/env/v8"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// Capture initializes the debug logging of the webhook with the API key and the
+// default TXT redact patterns and returns the log output of the test. The output,
+// level and formatter of the logger are restored when the test ends.
+func Capture(t testing.TB, apiKey string) *bytes.Buffer {
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	config.ApiKey = apiKey
+	config.Debug = true
+
+	logger := log.StandardLogger()
+	out, level, formatter := logger.Out, logger.GetLevel(), logger.Formatter
+	t.Cleanup(func() {
+		logger.SetOutput(out)
+		logger.SetLevel(level)
+		logger.SetFormatter(formatter)
+	})
+
+	logging.Init(&config)
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	return &buf
+}
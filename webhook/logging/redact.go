@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	log "github.com/sirupsen/logrus"
+)
+
+// headerPattern matches the values of HTTP headers carrying credentials, e.g.
+// `X-Api-Key: secret`, `"X-API-KEY":["secret"]` or `Authorization=Bearer secret`.
+var headerPattern = regexp.MustCompile(`(?i)((?:x-api-key|authorization)["']?\s*[:=]\s*\[?["']?)(?:bearer\s+|basic\s+)?[^\s"'\],}]+`)
+
+var redactor *Redactor
+
+// Redactor removes secrets from strings: the configured secret values and the
+// values of credential HTTP headers everywhere, and everything matching the
+// configured TXT record patterns from TXT record data.
+type Redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor creates a Redactor for the given secret values and TXT record
+// regular expressions. Empty secrets and patterns are ignored.
+func NewRedactor(secrets []string, txtPatterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	for _, p := range txtPatterns {
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact returns s with the secret values and credential header values
+// replaced by configuration.RedactedValue. The TXT patterns are not applied,
+// so host names and IDs of the same shape are kept.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, configuration.RedactedValue)
+	}
+	return headerPattern.ReplaceAllString(s, "${1}"+configuration.RedactedValue)
+}
+
+// RedactTXT returns the data of a TXT record with the secret values and
+// everything matching the TXT patterns replaced by configuration.RedactedValue.
+func (r *Redactor) RedactTXT(data string) string {
+	if r == nil || data == "" {
+		return data
+	}
+	data = r.Redact(data)
+	for _, re := range r.patterns {
+		data = re.ReplaceAllString(data, configuration.RedactedValue)
+	}
+	return data
+}
+
+// RedactRecords returns a copy of the zone records with the data of TXT
+// records redacted, see RedactTXT.
+func (r *Redactor) RedactRecords(records map[string]map[string][]internal.Record) map[string]map[string][]internal.Record {
+	if r == nil || len(r.patterns) == 0 {
+		return records
+	}
+	redacted := make(map[string]map[string][]internal.Record, len(records))
+	for name, recordTypes := range records {
+		redacted[name] = make(map[string][]internal.Record, len(recordTypes))
+		for recordType, recs := range recordTypes {
+			if !IsTXT(recordType) {
+				redacted[name][recordType] = recs
+				continue
+			}
+			redactedRecs := make([]internal.Record, 0, len(recs))
+			for _, rec := range recs {
+				rec.Data = r.RedactTXT(rec.Data)
+				redactedRecs = append(redactedRecs, rec)
+			}
+			redacted[name][recordType] = redactedRecs
+		}
+	}
+	return redacted
+}
+
+// IsTXT returns true if the record type is TXT.
+func IsTXT(recordType string) bool {
+	return strings.EqualFold(recordType, "TXT")
+}
+
+// Redact removes secrets from s using the redactor configured by Init. It is
+// meant for text leaving the webhook outside the logs, e.g. error responses.
+func Redact(s string) string {
+	return redactor.Redact(s)
+}
+
+// RedactTXT removes secrets from TXT record data using the redactor configured
+// by Init.
+func RedactTXT(data string) string {
+	return redactor.RedactTXT(data)
+}
+
+// RedactRecords redacts the TXT record data of zone records using the
+// redactor configured by Init.
+func RedactRecords(records map[string]map[string][]internal.Record) map[string]map[string][]internal.Record {
+	return redactor.RedactRecords(records)
+}
+
+// redactHook redacts the secrets in the message and fields of every log entry
+// using the redactor configured by Init. TXT record data is redacted where it
+// is logged, see RedactTXT.
+type redactHook struct{}
+
+func (h *redactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *redactHook) Fire(entry *log.Entry) error {
+	r := redactor
+	if r == nil {
+		return nil
+	}
+	entry.Message = r.Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = r.Redact(v)
+		case error:
+			if redacted := r.Redact(v.Error()); redacted != v.Error() {
+				entry.Data[key] = redacted
+			}
+		default:
+			s := fmt.Sprintf("%+v", v)
+			if redacted := r.Redact(s); redacted != s {
+				entry.Data[key] = redacted
+			}
+		}
+	}
+	return nil
+}
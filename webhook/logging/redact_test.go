@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/caarlos0/env/v8"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testApiKey   = "abion-test-api-key-1234"
+	testAcme     = "Zm9vYmFyYmF6cXV4cXV1eGNvcmdlZ3JhdWx0Z2FycGx"
+	testDkimData = "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC5"
+)
+
+func testRedactor(t *testing.T) *Redactor {
+	// use the default TXT patterns of the configuration
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	r, err := NewRedactor([]string{testApiKey}, config.LogRedactTXTPatterns)
+	assert.NoError(t, err)
+	return r
+}
+
+func Test_Redact(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected string
+	}
+
+	testCases := []testCase{
+		{
+			name:     "api key",
+			input:    "calling api with key " + testApiKey,
+			expected: "calling api with key [REDACTED]",
+		},
+		{
+			name:     "api key header",
+			input:    "request headers: X-Api-Key: other-key Accept: application/json",
+			expected: "request headers: X-Api-Key: [REDACTED] Accept: application/json",
+		},
+		{
+			name:     "api key header map",
+			input:    `map[Content-Type:[application/json] X-Api-Key:[other-key]]`,
+			expected: `map[Content-Type:[application/json] X-Api-Key:[[REDACTED]]]`,
+		},
+		{
+			name:     "authorization header json",
+			input:    `{"Authorization":"Bearer token"}`,
+			expected: `{"Authorization":"[REDACTED]"}`,
+		},
+		{
+			name:     "host name of txt pattern length",
+			input:    "resolving " + testAcme + ".example.com",
+			expected: "resolving " + testAcme + ".example.com",
+		},
+		{
+			name:     "no secrets",
+			input:    "processing zone example.com with 2 records",
+			expected: "processing zone example.com with 2 records",
+		},
+	}
+
+	r := testRedactor(t)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, r.Redact(tc.input))
+		})
+	}
+}
+
+func Test_RedactTXT(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected string
+	}
+
+	testCases := []testCase{
+		{
+			name:     "acme challenge",
+			input:    testAcme,
+			expected: "[REDACTED]",
+		},
+		{
+			name:     "dkim key",
+			input:    testDkimData,
+			expected: "v=DKIM1; k=rsa; [REDACTED]",
+		},
+		{
+			name:     "api key",
+			input:    "key=" + testApiKey,
+			expected: "key=[REDACTED]",
+		},
+		{
+			name:     "no secrets",
+			input:    "v=spf1 include:example.com ~all",
+			expected: "v=spf1 include:example.com ~all",
+		},
+	}
+
+	r := testRedactor(t)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, r.RedactTXT(tc.input))
+		})
+	}
+}
+
+func Test_RedactRecords(t *testing.T) {
+	records := map[string]map[string][]internal.Record{
+		"_acme-challenge": {"TXT": {{Data: testAcme, TTL: 300}}},
+		testAcme:          {"A": {{Data: "1.2.3.4"}}},
+	}
+
+	redacted := testRedactor(t).RedactRecords(records)
+
+	assert.Equal(t, map[string]map[string][]internal.Record{
+		"_acme-challenge": {"TXT": {{Data: configuration.RedactedValue, TTL: 300}}},
+		testAcme:          {"A": {{Data: "1.2.3.4"}}},
+	}, redacted)
+	assert.Equal(t, testAcme, records["_acme-challenge"]["TXT"][0].Data, "records must not be modified")
+}
+
+func Test_NewRedactor_InvalidPattern(t *testing.T) {
+	_, err := NewRedactor(nil, []string{"("})
+	assert.Error(t, err)
+}
+
+func Test_redactHook(t *testing.T) {
+	previous := redactor
+	redactor = testRedactor(t)
+	t.Cleanup(func() { redactor = previous })
+
+	for _, formatter := range []log.Formatter{&log.TextFormatter{}, &log.JSONFormatter{}} {
+		var buf bytes.Buffer
+		logger := log.New()
+		logger.SetOutput(&buf)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(log.DebugLevel)
+		logger.AddHook(&redactHook{})
+
+		header := http.Header{}
+		header.Set("X-API-KEY", testApiKey)
+		logger.Debugf("request with key %s", testApiKey)
+		logger.WithField("headers", header).Info("request headers")
+		logger.WithField("apiKey", testApiKey).Warn("api key field")
+		logger.WithError(errors.New("unauthorized key " + testApiKey)).Error("api error")
+		logger.WithField("request", testAcme).Info("request id of txt pattern length")
+
+		output := buf.String()
+		assert.NotContains(t, output, testApiKey)
+		assert.Contains(t, output, configuration.RedactedValue)
+		assert.Contains(t, output, testAcme, "TXT patterns must only be applied to TXT record data")
+	}
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaTypeBase         = "application/external.dns.webhook+json"
+	mediaTypeVersionParam = "version"
+	qualityParam          = "q"
+)
+
+// mediaTypeEncoder writes a response body in the format of a protocol version.
+type mediaTypeEncoder func(w io.Writer, v any) error
+
+// mediaTypeEncoders holds the supported protocol versions of the webhook media
+// type. Supporting a new protocol version is a matter of registering its encoder.
+var mediaTypeEncoders = map[string]mediaTypeEncoder{
+	"1": encodeJSON,
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// mediaTypeVersion returns the media type of the protocol version in the form
+// sent in responses, e.g. application/external.dns.webhook+json;version=1.
+func mediaTypeVersion(version string) string {
+	return mediaTypeBase + ";" + mediaTypeVersionParam + "=" + version
+}
+
+// supportedVersions returns the supported protocol versions, highest first.
+func supportedVersions() []string {
+	versions := make([]string, 0, len(mediaTypeEncoders))
+	for v := range mediaTypeEncoders {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		a, errA := strconv.Atoi(versions[i])
+		b, errB := strconv.Atoi(versions[j])
+		if errA != nil || errB != nil {
+			return versions[i] > versions[j]
+		}
+		return a > b
+	})
+	return versions
+}
+
+func unsupportedMediaTypeError(value string) error {
+	versions := supportedVersions()
+	supported := make([]string, 0, len(versions))
+	for _, v := range versions {
+		supported = append(supported, mediaTypeVersion(v))
+	}
+	return fmt.Errorf("unsupported media type version: '%s'. Supported media types are: '%s'", value, strings.Join(supported, ", "))
+}
+
+// parseContentType parses a Content-Type header value (RFC 7231 section 3.1.1.1)
+// and returns its protocol version. Type, subtype and parameter names are
+// matched case-insensitively and whitespace around parameters is ignored.
+func parseContentType(value string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err != nil || mediaType != mediaTypeBase {
+		return "", unsupportedMediaTypeError(value)
+	}
+	version := params[mediaTypeVersionParam]
+	if _, ok := mediaTypeEncoders[version]; !ok {
+		return "", unsupportedMediaTypeError(value)
+	}
+	return version, nil
+}
+
+// mediaRange is a media range of an Accept header with its q-value.
+type mediaRange struct {
+	mediaType string
+	params    map[string]string
+	quality   float64
+}
+
+// negotiateAccept parses an Accept header value (RFC 7231 section 5.3.2) and
+// returns the supported protocol version the client prefers. Each version is
+// weighted by the q-value of the most specific media range matching it, so
+// "application/external.dns.webhook+json;version=1;q=0, */*" excludes version
+// 1. Wildcards and the webhook media type without a version match every
+// supported version; of equally weighted versions the highest is selected.
+func negotiateAccept(value string) (string, error) {
+	var ranges []mediaRange
+	for _, r := range splitMediaRanges(value) {
+		mediaType, params, err := mime.ParseMediaType(r)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params[qualityParam]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, params: params, quality: quality})
+	}
+
+	bestVersion := ""
+	bestQuality := 0.0
+	for _, version := range supportedVersions() {
+		quality := 0.0
+		specificity := -1
+		for _, r := range ranges {
+			if s := matchMediaRange(r, version); s > specificity {
+				quality, specificity = r.quality, s
+			}
+		}
+		if quality > bestQuality {
+			bestVersion, bestQuality = version, quality
+		}
+	}
+
+	if bestVersion == "" {
+		return "", unsupportedMediaTypeError(value)
+	}
+	return bestVersion, nil
+}
+
+// matchMediaRange returns how specific the media range matches the protocol
+// version, or -1 if it doesn't match.
+func matchMediaRange(r mediaRange, version string) int {
+	switch r.mediaType {
+	case "*/*":
+		return 0
+	case "application/*":
+		return 1
+	case mediaTypeBase:
+		v, ok := r.params[mediaTypeVersionParam]
+		if !ok {
+			return 2
+		}
+		if v == version {
+			return 3
+		}
+	}
+	return -1
+}
+
+// splitMediaRanges splits a comma separated header value, ignoring commas
+// within quoted parameter values.
+func splitMediaRanges(value string) []string {
+	var ranges []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				ranges = append(ranges, strings.TrimSpace(value[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(ranges, strings.TrimSpace(value[start:]))
+}
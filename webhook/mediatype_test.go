@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseContentType(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   string
+		version string
+		err     bool
+	}{
+		{"exact", "application/external.dns.webhook+json;version=1", "1", false},
+		{"space before parameter", "application/external.dns.webhook+json; version=1", "1", false},
+		{"quoted parameter and upper case type", `Application/External.DNS.Webhook+JSON; Version="1"`, "1", false},
+		{"additional parameter", "application/external.dns.webhook+json;version=1;charset=utf-8", "1", false},
+		{"missing version", "application/external.dns.webhook+json", "", true},
+		{"unsupported version", "application/external.dns.webhook+json;version=2", "", true},
+		{"other media type", "application/json", "", true},
+		{"malformed", "application/external.dns.webhook+json;version", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := parseContentType(tc.value)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func Test_negotiateAccept(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   string
+		version string
+		err     bool
+	}{
+		{"exact", "application/external.dns.webhook+json;version=1", "1", false},
+		{"space before parameter", "application/external.dns.webhook+json; version=1", "1", false},
+		{"without version", "application/external.dns.webhook+json", "1", false},
+		{"list with q-values", "application/json;q=0.9, application/external.dns.webhook+json;version=2, application/external.dns.webhook+json;version=1;q=0.5", "1", false},
+		{"wildcard", "*/*", "1", false},
+		{"subtype wildcard", "application/*;q=0.8", "1", false},
+		{"excluded with q=0", "application/external.dns.webhook+json;version=1;q=0", "", true},
+		{"excluded with q=0 and wildcard", "application/external.dns.webhook+json;version=1;q=0, */*", "", true},
+		{"wildcard excluded with q=0", "*/*;q=0, application/external.dns.webhook+json", "1", false},
+		{"most specific range wins", "application/external.dns.webhook+json;version=1;q=0.2, application/*;q=0.9", "1", false},
+		{"unsupported version", "application/external.dns.webhook+json;version=2", "", true},
+		{"other media type", "text/html, application/json", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := negotiateAccept(tc.value)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func Test_negotiateAccept_Versions(t *testing.T) {
+	defer func(encoders map[string]mediaTypeEncoder) { mediaTypeEncoders = encoders }(mediaTypeEncoders)
+	mediaTypeEncoders = map[string]mediaTypeEncoder{"1": encodeJSON, "2": encodeJSON}
+
+	testCases := []struct {
+		name    string
+		value   string
+		version string
+	}{
+		{"wildcard", "*/*", "2"},
+		{"highest excluded with q=0", "application/external.dns.webhook+json;version=2;q=0, */*", "1"},
+		{"preferred lower version", "application/external.dns.webhook+json;version=1, application/external.dns.webhook+json;version=2;q=0.5", "1"},
+		{"version preferred over wildcard", "application/external.dns.webhook+json;version=1;q=0.8, */*;q=0.5", "1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := negotiateAccept(tc.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func Test_unsupportedMediaTypeError(t *testing.T) {
+	defer func(encoders map[string]mediaTypeEncoder) { mediaTypeEncoders = encoders }(mediaTypeEncoders)
+	mediaTypeEncoders = map[string]mediaTypeEncoder{"1": encodeJSON, "2": encodeJSON}
+
+	err := unsupportedMediaTypeError("text/plain")
+
+	assert.EqualError(t, err, "unsupported media type version: 'text/plain'. Supported media types are: "+
+		"'application/external.dns.webhook+json;version=2, application/external.dns.webhook+json;version=1'")
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "abion_webhook"
+
+var registry = prometheus.NewRegistry()
+
+// DryRunChanges is the number of record changes per zone and change kind
+// (added, removed, changed) computed by the latest dry-run ApplyChanges.
+var DryRunChanges = register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "dry_run_changes",
+	Help:      "Number of record changes per zone computed by the latest dry-run apply.",
+}, []string{"zone", "change"}))
+
+// CircuitBreakerState is the state of the Abion API circuit breaker: 0 closed,
+// 1 half-open and 2 open.
+var CircuitBreakerState = register(prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "api_circuit_breaker_state",
+	Help:      "State of the Abion API circuit breaker (0 closed, 1 half-open, 2 open).",
+}))
+
+// TTLClamped counts the record TTLs raised to the minimum or lowered to the
+// maximum TTL of the TTL policy, per record type and bound (min, max).
+var TTLClamped = register(prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "ttl_clamped_total",
+	Help:      "Number of record TTLs clamped to the minimum or maximum TTL.",
+}, []string{"record_type", "bound"}))
+
+// ZoneApplies counts the ApplyChanges outcomes per zone and outcome (applied,
+// partial, rolled-back, failed).
+var ZoneApplies = register(prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "zone_applies_total",
+	Help:      "Number of zone changes applied per zone and outcome.",
+}, []string{"zone", "outcome"}))
+
+// Handler returns the HTTP handler exposing the webhook metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func register[T prometheus.Collector](c T) T {
+	registry.MustRegister(c)
+	return c
+}
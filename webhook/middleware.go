@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/abiondevelopment/external-dns-webhook-abion/webhook")
+
+const (
+	logFieldStatus   = "status"
+	logFieldDuration = "duration"
+	logFieldBytes    = "bytes"
+	maxRequestIDLen  = 128
+)
+
+// RequestID assigns a request ID to every request, or propagates the one sent in
+// the X-Request-ID header. The ID is stored in the request context, so it is
+// added to the provider and Abion client logs and sent to the Abion API, and it
+// is returned in the X-Request-ID response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLen {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(internal.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type accessLogKey struct{}
+
+// accessLogFields holds additional fields handlers add to the access log line.
+type accessLogFields struct {
+	mu     sync.Mutex
+	fields log.Fields
+}
+
+// addAccessLogFields adds fields to the access log line of the request.
+func addAccessLogFields(ctx context.Context, fields log.Fields) {
+	a, ok := ctx.Value(accessLogKey{}).(*accessLogFields)
+	if !ok {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, v := range fields {
+		a.fields[k] = v
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// AccessLog logs one structured line per request with the response status,
+// duration, response size and the fields added by the handler.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		extra := &accessLogFields{fields: log.Fields{}}
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, extra))
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		extra.mu.Lock()
+		defer extra.mu.Unlock()
+		requestLog(r).WithFields(extra.fields).WithFields(log.Fields{
+			logFieldStatus:   recorder.status,
+			logFieldDuration: time.Since(start).String(),
+			logFieldBytes:    recorder.bytes,
+		}).Info("request completed")
+	})
+}
+
+// Tracing starts a server span for every request, continuing the trace of the
+// caller if it sent a trace context.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("webhook.request_id", internal.RequestIDFromContext(ctx)),
+			))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging/loggingtest"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logLines returns the JSON log lines written to the buffer of loggingtest.Capture.
+func logLines(t *testing.T, output string) []map[string]any {
+	var lines []map[string]any
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		var line map[string]any
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func Test_RequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	testCases := []struct {
+		name      string
+		header    string
+		generated bool
+	}{
+		{name: "generated", generated: true},
+		{name: "propagated", header: "external-dns-42"},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLen+1), generated: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var contextID string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = internal.RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/records", nil)
+			if tc.header != "" {
+				req.Header.Set(requestIDHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(requestIDHeader)
+			assert.Equal(t, requestID, contextID)
+			if tc.generated {
+				assert.Regexp(t, generated, requestID)
+			} else {
+				assert.Equal(t, tc.header, requestID)
+			}
+		})
+	}
+}
+
+func Test_AccessLog(t *testing.T) {
+	buf := loggingtest.Capture(t, "secret-key")
+	log.SetFormatter(&log.JSONFormatter{})
+
+	testCases := []struct {
+		name   string
+		status int
+		body   string
+		fields log.Fields
+	}{
+		{name: "implicit status"},
+		{name: "handler fields", status: http.StatusCreated, body: "created", fields: log.Fields{"create": 2}},
+		{name: "error status", status: http.StatusInternalServerError, body: "failed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			handler := RequestID(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				addAccessLogFields(r.Context(), tc.fields)
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				_, _ = w.Write([]byte(tc.body))
+			})))
+
+			req := httptest.NewRequest(http.MethodPost, "/records", nil)
+			req.Header.Set(requestIDHeader, "external-dns-42")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := logLines(t, buf.String())
+			if !assert.Len(t, lines, 1) {
+				return
+			}
+			line := lines[0]
+			status := tc.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			assert.Equal(t, "request completed", line["msg"])
+			assert.Equal(t, "external-dns-42", line[logging.FieldRequestID])
+			assert.Equal(t, http.MethodPost, line[logFieldRequestMethod])
+			assert.Equal(t, "/records", line[logFieldRequestPath])
+			assert.EqualValues(t, status, line[logFieldStatus])
+			assert.EqualValues(t, len(tc.body), line[logFieldBytes])
+			assert.NotEmpty(t, line[logFieldDuration])
+			for k, v := range tc.fields {
+				assert.EqualValues(t, v, line[k], k)
+			}
+		})
+	}
+}
+
+func Test_AdjustEndpoints_RequestID(t *testing.T) {
+	buf := loggingtest.Capture(t, "secret-key")
+	log.SetFormatter(&log.JSONFormatter{})
+
+	handler := RequestID(http.HandlerFunc(New(&dnsprovider.AbionProvider{}).AdjustEndpoints))
+	body := `[{"dnsName":"www.bücher.abion.test","recordType":"A","targets":["192.0.2.1"]}]`
+	req := httptest.NewRequest(http.MethodPost, "/adjustendpoints", strings.NewReader(body))
+	req.Header.Set(contentTypeHeader, testMediaType)
+	req.Header.Set(acceptHeader, testMediaType)
+	req.Header.Set(requestIDHeader, "external-dns-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "www.xn--bcher-kva.abion.test")
+
+	var converted bool
+	for _, line := range logLines(t, buf.String()) {
+		assert.Equal(t, "external-dns-42", line[logging.FieldRequestID], line["msg"])
+		converted = converted || strings.HasPrefix(line["msg"].(string), "Converted DNS name")
+	}
+	assert.True(t, converted)
+}
+
+func Test_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+	testCases := []struct {
+		name   string
+		status int
+		code   codes.Code
+		parent bool
+	}{
+		{name: "new trace", status: http.StatusNoContent, code: codes.Unset},
+		{name: "continued trace", status: http.StatusOK, code: codes.Unset, parent: true},
+		{name: "client error", status: http.StatusBadRequest, code: codes.Unset, parent: true},
+		{name: "server error", status: http.StatusInternalServerError, code: codes.Error, parent: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var handlerSpan trace.SpanContext
+			handler := RequestID(Tracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerSpan = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(tc.status)
+			})))
+
+			req := httptest.NewRequest(http.MethodPost, "/records", nil)
+			req.Header.Set(requestIDHeader, "external-dns-42")
+			if tc.parent {
+				req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if !assert.NotEmpty(t, spans) {
+				return
+			}
+			span := spans[len(spans)-1]
+			assert.Equal(t, "POST /records", span.Name())
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+			assert.Equal(t, span.SpanContext(), handlerSpan, "the handler runs in the server span")
+			for _, attr := range []attribute.KeyValue{
+				attribute.String("http.request.method", http.MethodPost),
+				attribute.String("url.path", "/records"),
+				attribute.String("webhook.request_id", "external-dns-42"),
+				attribute.Int("http.response.status_code", tc.status),
+			} {
+				assert.Contains(t, span.Attributes(), attr)
+			}
+			assert.Equal(t, tc.code, span.Status().Code)
+			if tc.parent {
+				assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+				assert.Equal(t, parentSpanID, span.Parent().SpanID().String())
+			} else {
+				assert.False(t, span.Parent().IsValid())
+			}
+		})
+	}
+}
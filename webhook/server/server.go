@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/admin"
 	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/metrics"
 	"github.com/go-chi/chi/v5"
 
 	log "github.com/sirupsen/logrus"
@@ -23,22 +25,67 @@ import (
 // - /records (GET): returns the current records
 // - /records (POST): applies the changes
 // - /adjustendpoints (POST): executes the AdjustEndpoints method
+// - /metrics (GET): returns the webhook metrics
+// - /readyz (GET): returns 503 while the Abion API circuit breaker is open
 func Init(config configuration.Configuration, p *webhook.Webhook) *http.Server {
+	srv := newServer(config, p)
+	listenAndServe(srv)
+	return srv
+}
+
+func newServer(config configuration.Configuration, p *webhook.Webhook) *http.Server {
 	r := chi.NewRouter()
 	r.Use(webhook.Health)
-	r.Get("/", p.Negotiate)
-	r.Get("/records", p.Records)
-	r.Post("/records", p.ApplyChanges)
-	r.Post("/adjustendpoints", p.AdjustEndpoints)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	r.Get("/readyz", p.Ready)
+	r.Group(func(r chi.Router) {
+		r.Use(webhook.RequestID)
+		r.Use(webhook.AccessLog)
+		r.Use(webhook.Tracing)
+		r.Get("/", p.Negotiate)
+		r.Get("/records", p.Records)
+		r.Post("/records", p.ApplyChanges)
+		r.Post("/adjustendpoints", p.AdjustEndpoints)
+	})
+
+	return createHTTPServer(fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort), r, config.ServerReadTimeout, config.ServerWriteTimeout)
+}
+
+// InitAdmin admin server initialization function
+// The admin server will respond to the following endpoints:
+// - /admin/dryrun (GET): returns the change counts per zone of the latest dry run
+// - /admin/loglevel (GET): returns the current log level
+// - /admin/loglevel (PUT): changes the log level
+// - /admin/cache/flush (POST): clears the cached zones
+// - /admin/zones (GET): returns the managed zones and their flags
+// - /admin/config (GET): returns the effective configuration with secrets redacted
+// The endpoints are not authenticated, the server listens on ADMIN_HOST which
+// defaults to localhost.
+func InitAdmin(config configuration.Configuration, a *admin.Admin) *http.Server {
+	srv := newAdminServer(config, a)
+	listenAndServe(srv)
+	return srv
+}
+
+func newAdminServer(config configuration.Configuration, a *admin.Admin) *http.Server {
+	r := chi.NewRouter()
+	r.Get("/admin/dryrun", a.DryRun)
+	r.Get("/admin/loglevel", a.GetLogLevel)
+	r.Put("/admin/loglevel", a.SetLogLevel)
+	r.Post("/admin/cache/flush", a.FlushCache)
+	r.Get("/admin/zones", a.Zones)
+	r.Get("/admin/config", a.Config)
 
-	srv := createHTTPServer(fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort), r, config.ServerReadTimeout, config.ServerWriteTimeout)
+	return createHTTPServer(fmt.Sprintf("%s:%d", config.AdminHost, config.AdminPort), r, config.ServerReadTimeout, config.ServerWriteTimeout)
+}
+
+func listenAndServe(srv *http.Server) {
 	go func() {
 		log.Infof("starting server on addr: '%s' ", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Errorf("can't serve on addr: '%s', error: %v", srv.Addr, err)
 		}
 	}()
-	return srv
 }
 
 func createHTTPServer(addr string, hand http.Handler, readTimeout, writeTimeout time.Duration) *http.Server {
@@ -50,15 +97,17 @@ func createHTTPServer(addr string, hand http.Handler, readTimeout, writeTimeout
 	}
 }
 
-// ShutdownGracefully gracefully shutdown the http server
-func ShutdownGracefully(srv *http.Server) {
+// ShutdownGracefully gracefully shutdown the http servers
+func ShutdownGracefully(servers ...*http.Server) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	sig := <-sigCh
 	log.Infof("shutting down server due to received signal: %v", sig)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Errorf("error shutting down server: %v", err)
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Errorf("error shutting down server: %v", err)
+		}
 	}
 	cancel()
 }
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/admin"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/caarlos0/env/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func status(srv *http.Server, method, path string) int {
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec.Code
+}
+
+func Test_newAdminServer(t *testing.T) {
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	provider := &dnsprovider.AbionProvider{}
+
+	adminSrv := newAdminServer(config, admin.New(provider, config))
+	assert.Equal(t, "localhost:8889", adminSrv.Addr, "admin endpoints are unauthenticated and bound to localhost by default")
+	assert.Equal(t, http.StatusOK, status(adminSrv, http.MethodGet, "/admin/config"))
+	assert.Equal(t, http.StatusMethodNotAllowed, status(adminSrv, http.MethodPost, "/admin/config"))
+	assert.Equal(t, http.StatusNotFound, status(adminSrv, http.MethodGet, "/records"))
+
+	config.AdminHost = "0.0.0.0"
+	config.AdminPort = 9999
+	assert.Equal(t, "0.0.0.0:9999", newAdminServer(config, admin.New(provider, config)).Addr)
+
+	srv := newServer(config, webhook.New(provider))
+	assert.Equal(t, "localhost:8888", srv.Addr)
+	assert.Equal(t, http.StatusNotFound, status(srv, http.MethodGet, "/admin/config"), "admin endpoints are not served by the webhook server")
+}
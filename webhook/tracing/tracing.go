@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	serviceName    = "external-dns-webhook-abion"
+	exporterOTLP   = "otlp"
+	exporterStdout = "stdout"
+)
+
+// ShutdownFunc flushes and stops the trace exporter.
+type ShutdownFunc func(ctx context.Context) error
+
+// Init sets up the global OpenTelemetry tracer provider if tracing is enabled.
+// The OTLP exporter is configured through the standard OTEL_EXPORTER_OTLP_*
+// environment variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT.
+func Init(ctx context.Context, config *configuration.Configuration, version string) (ShutdownFunc, error) {
+	if !config.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.TracingExporter {
+	case exporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case exporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter: '%s'. Supported exporters are: '%s', '%s'", config.TracingExporter, exporterOTLP, exporterStdout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s trace exporter: %w", config.TracingExporter, err)
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version),
+	)
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	log.Infof("tracing enabled, exporter: %s, sample ratio: %v", config.TracingExporter, config.TracingSampleRatio)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/configuration"
+	"github.com/caarlos0/env/v8"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func Test_Init_Disabled(t *testing.T) {
+	config := configuration.Configuration{}
+	assert.NoError(t, env.Parse(&config))
+	provider := otel.GetTracerProvider()
+
+	shutdown, err := Init(context.Background(), &config, "test")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Equal(t, provider, otel.GetTracerProvider(), "the global tracer provider is left alone")
+}
+
+func Test_Init_UnsupportedExporter(t *testing.T) {
+	config := configuration.Configuration{TracingEnabled: true, TracingExporter: "jaeger"}
+
+	shutdown, err := Init(context.Background(), &config, "test")
+	assert.Nil(t, shutdown)
+	assert.EqualError(t, err, "unsupported tracing exporter: 'jaeger'. Supported exporters are: 'otlp', 'stdout'")
+}
+
+func Test_Init_Stdout(t *testing.T) {
+	provider, propagator, stdout := otel.GetTracerProvider(), otel.GetTextMapPropagator(), os.Stdout
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+		os.Stdout = stdout
+	})
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer out.Close()
+	os.Stdout = out
+
+	config := configuration.Configuration{TracingEnabled: true, TracingExporter: exporterStdout, TracingSampleRatio: 1}
+	shutdown, err := Init(context.Background(), &config, "1.2.3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ElementsMatch(t, []string{"traceparent", "tracestate", "baggage"}, otel.GetTextMapPropagator().Fields())
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test span")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()), "the shutdown flushes the batched spans")
+
+	exported, err := os.ReadFile(out.Name())
+	assert.NoError(t, err)
+	assert.Contains(t, string(exported), `"Name":"test span"`)
+	assert.Contains(t, string(exported), serviceName)
+	assert.Contains(t, string(exported), "1.2.3")
+}
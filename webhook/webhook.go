@@ -1,12 +1,15 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging"
 	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
@@ -14,48 +17,19 @@ import (
 )
 
 const (
-	mediaTypeFormat        = "application/external.dns.webhook+json;"
-	contentTypeHeader      = "Content-Type"
-	contentTypePlaintext   = "text/plain"
-	acceptHeader           = "Accept"
-	varyHeader             = "Vary"
-	supportedMediaVersions = "1"
-	healthPath             = "/healthz"
-	logFieldRequestPath    = "requestPath"
-	logFieldRequestMethod  = "requestMethod"
-	logFieldError          = "error"
-	maxRequestBodySize     = 10 << 20 // 10 MB
+	contentTypeHeader     = "Content-Type"
+	contentTypePlaintext  = "text/plain"
+	contentTypeJSON       = "application/json"
+	acceptHeader          = "Accept"
+	varyHeader            = "Vary"
+	requestIDHeader       = "X-Request-ID"
+	healthPath            = "/healthz"
+	logFieldRequestPath   = "requestPath"
+	logFieldRequestMethod = "requestMethod"
+	logFieldError         = "error"
+	maxRequestBodySize    = 10 << 20 // 10 MB
 )
 
-var mediaTypeVersion1 = mediaTypeVersion("1")
-
-type mediaType string
-
-func mediaTypeVersion(v string) mediaType {
-	return mediaType(mediaTypeFormat + "version=" + v)
-}
-
-func (m mediaType) Is(headerValue string) bool {
-	return string(m) == headerValue
-}
-
-func checkAndGetMediaTypeHeaderValue(value string) (string, error) {
-	for _, v := range strings.Split(supportedMediaVersions, ",") {
-		if mediaTypeVersion(v).Is(value) {
-			return v, nil
-		}
-	}
-	supportedMediaTypesString := ""
-	for i, v := range strings.Split(supportedMediaVersions, ",") {
-		sep := ""
-		if i < len(supportedMediaVersions)-1 {
-			sep = ", "
-		}
-		supportedMediaTypesString += string(mediaTypeVersion(v)) + sep
-	}
-	return "", fmt.Errorf("unsupported media type version: '%s'. Supported media types are: '%s'", value, supportedMediaTypesString)
-}
-
 // Webhook for external dns provider
 type Webhook struct {
 	provider provider.Provider
@@ -77,15 +51,41 @@ func Health(next http.Handler) http.Handler {
 	})
 }
 
-func (p *Webhook) contentTypeHeaderCheck(w http.ResponseWriter, r *http.Request) error {
+// readinessChecker is implemented by providers that can report whether they
+// are able to serve requests.
+type readinessChecker interface {
+	Ready() error
+}
+
+// Ready responds with 503 Service Unavailable while the provider is not ready,
+// e.g. while the Abion API circuit breaker is open.
+func (p *Webhook) Ready(w http.ResponseWriter, r *http.Request) {
+	if checker, ok := p.provider.(readinessChecker); ok {
+		if err := checker.Ready(); err != nil {
+			w.Header().Set(contentTypeHeader, contentTypePlaintext)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if _, writeErr := fmt.Fprint(w, err.Error()); writeErr != nil {
+				requestLog(r).WithField(logFieldError, writeErr).Error("error writing ready response")
+			}
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// contentTypeHeaderCheck checks the Content-Type header and returns the protocol
+// version of the request body.
+func (p *Webhook) contentTypeHeaderCheck(w http.ResponseWriter, r *http.Request) (string, error) {
 	return p.headerCheck(true, w, r)
 }
 
-func (p *Webhook) acceptHeaderCheck(w http.ResponseWriter, r *http.Request) error {
+// acceptHeaderCheck negotiates the protocol version of the response from the
+// Accept header.
+func (p *Webhook) acceptHeaderCheck(w http.ResponseWriter, r *http.Request) (string, error) {
 	return p.headerCheck(false, w, r)
 }
 
-func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http.Request) error {
+func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http.Request) (string, error) {
 	var header string
 	if isContentType {
 		header = r.Header.Get(contentTypeHeader)
@@ -106,10 +106,17 @@ func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http
 		if writeErr != nil {
 			requestLog(r).WithField(logFieldError, writeErr).Fatalf("error writing error message to response writer")
 		}
-		return err
+		return "", err
+	}
+
+	var version string
+	var err error
+	if isContentType {
+		version, err = parseContentType(header)
+	} else {
+		version, err = negotiateAccept(header)
 	}
-	// as we support only one media type version, we can ignore the returned value
-	if _, err := checkAndGetMediaTypeHeaderValue(header); err != nil {
+	if err != nil {
 		w.Header().Set(contentTypeHeader, contentTypePlaintext)
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 		msg := "client must provide a valid versioned media type in the "
@@ -123,14 +130,25 @@ func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http
 		if writeErr != nil {
 			requestLog(r).WithField(logFieldError, writeErr).Fatalf("error writing error message to response writer")
 		}
-		return err
+		return "", err
+	}
+	return version, nil
+}
+
+// writeVersioned writes the response body with the encoder of the negotiated
+// protocol version.
+func writeVersioned(w http.ResponseWriter, r *http.Request, version string, v any) {
+	w.Header().Set(contentTypeHeader, mediaTypeVersion(version))
+	w.Header().Set(varyHeader, acceptHeader)
+	if err := mediaTypeEncoders[version](w, v); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("error writing response")
 	}
-	return nil
 }
 
 // Records handles the get request for records
 func (p *Webhook) Records(w http.ResponseWriter, r *http.Request) {
-	if err := p.acceptHeaderCheck(w, r); err != nil {
+	version, err := p.acceptHeaderCheck(w, r)
+	if err != nil {
 		requestLog(r).WithField(logFieldError, err).Error("accept header check failed")
 		return
 	}
@@ -139,23 +157,16 @@ func (p *Webhook) Records(w http.ResponseWriter, r *http.Request) {
 	records, err := p.provider.Records(ctx)
 	if err != nil {
 		requestLog(r).WithField(logFieldError, err).Error("error getting records")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProviderError(w, r, err)
 		return
 	}
 	requestLog(r).Debugf("returning records count: %d", len(records))
-	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
-	w.Header().Set(varyHeader, contentTypeHeader)
-	err = json.NewEncoder(w).Encode(records)
-	if err != nil {
-		requestLog(r).WithField(logFieldError, err).Error("error encoding records")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	writeVersioned(w, r, version, records)
 }
 
 // ApplyChanges handles the post request for record changes
 func (p *Webhook) ApplyChanges(w http.ResponseWriter, r *http.Request) {
-	if err := p.contentTypeHeaderCheck(w, r); err != nil {
+	if _, err := p.contentTypeHeaderCheck(w, r); err != nil {
 		requestLog(r).WithField(logFieldError, err).Error("content type header check failed")
 		return
 	}
@@ -174,22 +185,35 @@ func (p *Webhook) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 	}
 	requestLog(r).Debugf("requesting apply changes, create: %d , updateOld: %d, updateNew: %d, delete: %d",
 		len(changes.Create), len(changes.UpdateOld), len(changes.UpdateNew), len(changes.Delete))
+	addAccessLogFields(ctx, log.Fields{
+		"create":    len(changes.Create),
+		"updateOld": len(changes.UpdateOld),
+		"updateNew": len(changes.UpdateNew),
+		"delete":    len(changes.Delete),
+	})
 	if err := p.provider.ApplyChanges(ctx, &changes); err != nil {
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusInternalServerError)
+		requestLog(r).WithField(logFieldError, err).Error("error applying changes")
+		writeProviderError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// contextAdjuster is implemented by providers adjusting endpoints with the
+// context of the request.
+type contextAdjuster interface {
+	AdjustEndpointsContext(ctx context.Context, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint
+}
+
 // AdjustEndpoints handles the post request for adjusting endpoints
 func (p *Webhook) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
-	if err := p.contentTypeHeaderCheck(w, r); err != nil {
-		log.Errorf("content type header check failed, request method: %s, request path: %s", r.Method, r.URL.Path)
+	if _, err := p.contentTypeHeaderCheck(w, r); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("content type header check failed")
 		return
 	}
-	if err := p.acceptHeaderCheck(w, r); err != nil {
-		log.Errorf("accept header check failed, request method: %s, request path: %s", r.Method, r.URL.Path)
+	version, err := p.acceptHeaderCheck(w, r)
+	if err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("accept header check failed")
 		return
 	}
 
@@ -199,42 +223,87 @@ func (p *Webhook) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(contentTypeHeader, contentTypePlaintext)
 		w.WriteHeader(http.StatusBadRequest)
 		errMessage := fmt.Sprintf("failed to decode request body: %v", err)
-		log.Infof(errMessage+" , request method: %s, request path: %s", r.Method, r.URL.Path)
+		requestLog(r).WithField(logFieldError, err).Info(errMessage)
 		if _, writeError := fmt.Fprint(w, errMessage); writeError != nil {
 			requestLog(r).WithField(logFieldError, writeError).Fatalf("error writing error message to response writer")
 		}
 		return
 	}
-	log.Debugf("requesting adjust endpoints count: %d", len(pve))
-	pve = p.provider.AdjustEndpoints(pve)
-	out, _ := json.Marshal(&pve)
-	log.Debugf("return adjust endpoints response, resultEndpointCount: %d", len(pve))
-	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
-	w.Header().Set(varyHeader, contentTypeHeader)
-	if _, writeError := fmt.Fprint(w, string(out)); writeError != nil {
-		requestLog(r).WithField(logFieldError, writeError).Fatalf("error writing response")
+	requestLog(r).Debugf("requesting adjust endpoints count: %d", len(pve))
+	if adjuster, ok := p.provider.(contextAdjuster); ok {
+		pve = adjuster.AdjustEndpointsContext(r.Context(), pve)
+	} else {
+		pve = p.provider.AdjustEndpoints(pve)
 	}
+	requestLog(r).Debugf("return adjust endpoints response, resultEndpointCount: %d", len(pve))
+	writeVersioned(w, r, version, pve)
 }
 
 func (p *Webhook) Negotiate(w http.ResponseWriter, r *http.Request) {
-	if err := p.acceptHeaderCheck(w, r); err != nil {
+	version, err := p.acceptHeaderCheck(w, r)
+	if err != nil {
 		requestLog(r).WithField(logFieldError, err).Error("accept header check failed")
 		return
 	}
 	b, err := p.provider.GetDomainFilter().MarshalJSON()
 	if err != nil {
-		log.Errorf("failed to marshal domain filter, request method: %s, request path: %s", r.Method, r.URL.Path)
+		requestLog(r).WithField(logFieldError, err).Error("failed to marshal domain filter")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
-	if _, writeError := w.Write(b); writeError != nil {
-		requestLog(r).WithField(logFieldError, writeError).Error("error writing response")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	writeVersioned(w, r, version, json.RawMessage(b))
+}
+
+type errorResponse struct {
+	Zone   string   `json:"zone,omitempty"`
+	Zones  []string `json:"zones,omitempty"`
+	Reason string   `json:"reason"`
+}
+
+// writeProviderError writes a JSON error body with the first failing zone, all
+// failing zones and the reason, with the status of errorStatusCode.
+func writeProviderError(w http.ResponseWriter, r *http.Request, err error) {
+	resp := errorResponse{Reason: logging.Redact(err.Error())}
+	var zoneErr *dnsprovider.ZoneError
+	if errors.As(err, &zoneErr) {
+		resp.Zone = zoneErr.Zone
+	}
+	var applyErr *dnsprovider.ApplyError
+	if errors.As(err, &applyErr) {
+		for _, zoneErr := range applyErr.Zones {
+			resp.Zones = append(resp.Zones, zoneErr.Zone)
+		}
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	w.WriteHeader(errorStatusCode(err))
+	if encodeErr := json.NewEncoder(w).Encode(resp); encodeErr != nil {
+		requestLog(r).WithField(logFieldError, encodeErr).Error("error writing error response")
+	}
+}
+
+// errorStatusCode returns the status of a provider error:
+//   - 503 Service Unavailable for transient errors, including rate limited
+//     calls, so external-dns retries them quietly, see dnsprovider.SoftError,
+//   - 422 Unprocessable Entity for changes rejected by the provider before
+//     calling the Abion API, see dnsprovider.IsValidationError,
+//   - the status of other 4xx errors of the Abion API, e.g. 401 for an invalid
+//     API key,
+//   - 500 Internal Server Error otherwise.
+func errorStatusCode(err error) int {
+	if errors.Is(err, dnsprovider.SoftError) {
+		return http.StatusServiceUnavailable
+	}
+	if dnsprovider.IsValidationError(err) {
+		return http.StatusUnprocessableEntity
+	}
+	var apiErr *internal.Error
+	if errors.As(err, &apiErr) && apiErr.Status >= http.StatusBadRequest && apiErr.Status < http.StatusInternalServerError {
+		return apiErr.Status
 	}
+	return http.StatusInternalServerError
 }
 
 func requestLog(r *http.Request) *log.Entry {
-	return log.WithFields(log.Fields{logFieldRequestMethod: r.Method, logFieldRequestPath: r.URL.Path})
+	return log.WithContext(r.Context()).WithFields(log.Fields{logFieldRequestMethod: r.Method, logFieldRequestPath: r.URL.Path})
 }
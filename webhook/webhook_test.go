@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/dnsprovider"
+	"github.com/abiondevelopment/external-dns-webhook-abion/webhook/logging/loggingtest"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+const (
+	testMediaType = "application/external.dns.webhook+json;version=1"
+	// testAcme is an ACME challenge token, matched by the default TXT redact
+	// patterns like other 43 character strings.
+	testAcme = "Zm9vYmFyYmF6cXV4cXV1eGNvcmdlZ3JhdWx0Z2FycGx"
+)
+
+// fakeClient serves a single zone with the configured records and returns the
+// configured errors.
+type fakeClient struct {
+	zone     string
+	records  map[string]map[string][]internal.Record
+	getErr   error
+	patchErr error
+	patches  []internal.ZoneRequest
+}
+
+func (c *fakeClient) GetZones(ctx context.Context, page *internal.Pagination) (*internal.APIResponse[[]internal.Zone], error) {
+	return &internal.APIResponse[[]internal.Zone]{
+		Meta: &internal.Metadata{Pagination: &internal.Pagination{Offset: 0, Limit: page.Limit, Total: 1}},
+		Data: []internal.Zone{{Type: "zone", ID: c.zone}},
+	}, nil
+}
+
+func (c *fakeClient) GetZone(ctx context.Context, name string) (*internal.APIResponse[*internal.Zone], error) {
+	if c.getErr != nil {
+		return nil, c.getErr
+	}
+	return &internal.APIResponse[*internal.Zone]{
+		Data: &internal.Zone{Type: "zone", ID: c.zone, Attributes: internal.Attributes{Records: c.records}},
+	}, nil
+}
+
+func (c *fakeClient) PatchZone(ctx context.Context, name string, patch internal.ZoneRequest) (*internal.APIResponse[*internal.Zone], error) {
+	if c.patchErr != nil {
+		return nil, c.patchErr
+	}
+	c.patches = append(c.patches, patch)
+	return &internal.APIResponse[*internal.Zone]{Data: &patch.Data}, nil
+}
+
+// errorProvider fails reading records and applying changes with err.
+type errorProvider struct {
+	provider.BaseProvider
+	err error
+}
+
+func (p *errorProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	return nil, p.err
+}
+
+func (p *errorProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	return p.err
+}
+
+func Test_ApplyChanges_Redaction(t *testing.T) {
+	// request IDs have the length of ACME tokens
+	const requestID = "abcdefghijklmnopqrstuvwxyz0123456789abcdefg"
+	buf := loggingtest.Capture(t, "secret-key")
+
+	client := &fakeClient{
+		zone:    "abion.test",
+		records: map[string]map[string][]internal.Record{"_acme-challenge": {"CNAME": {{Data: "acme.abion.test."}}}},
+	}
+	handler := RequestID(AccessLog(http.HandlerFunc(New(&dnsprovider.AbionProvider{Client: client}).ApplyChanges)))
+
+	body := `{"Create":[{"dnsName":"_acme-challenge.abion.test","recordType":"TXT","targets":["` + testAcme + `"]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(body))
+	req.Header.Set(contentTypeHeader, testMediaType)
+	req.Header.Set(requestIDHeader, requestID)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "conflicts with existing record _acme-challenge.abion.test CNAME")
+	assert.NotContains(t, rec.Body.String(), testAcme)
+
+	output := buf.String()
+	assert.Contains(t, output, "error applying changes")
+	assert.NotContains(t, output, testAcme)
+	assert.Contains(t, output, requestID, "TXT patterns must only be applied to TXT record data")
+}
+
+func Test_errorStatusCode(t *testing.T) {
+	rejected := &dnsprovider.EndpointError{
+		Endpoint: &endpoint.Endpoint{DNSName: "www.abion.test", RecordType: "CNAME", Targets: endpoint.Targets{"lb.abion.test"}},
+		Err:      dnsprovider.ErrCNAMEConflict,
+	}
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"soft error", dnsprovider.NewSoftError(&internal.Error{Status: 429, Message: "Too Many Requests"}), http.StatusServiceUnavailable},
+		{"unmanaged record type", errors.Join(fmt.Errorf("%w MX of mail.abion.test", dnsprovider.ErrUnmanagedRecordType)), http.StatusUnprocessableEntity},
+		{"invalid dns name", fmt.Errorf("%w %q", dnsprovider.ErrInvalidDnsName, "a..abion.test"), http.StatusUnprocessableEntity},
+		{"apex cname", &dnsprovider.ApplyError{Zones: []*dnsprovider.ZoneError{{Zone: "abion.test", Err: errors.Join(fmt.Errorf("%w: abion.test", dnsprovider.ErrApexCNAME))}}}, http.StatusUnprocessableEntity},
+		{"cname conflict", &dnsprovider.ApplyError{Zones: []*dnsprovider.ZoneError{{Zone: "abion.test", Err: errors.Join(rejected)}}}, http.StatusUnprocessableEntity},
+		{"invalid target", &dnsprovider.ApplyError{Zones: []*dnsprovider.ZoneError{{Zone: "abion.test", Err: errors.Join(&dnsprovider.EndpointError{Endpoint: rejected.Endpoint, Err: dnsprovider.ErrInvalidTarget})}}}, http.StatusUnprocessableEntity},
+		{"duplicate target", &dnsprovider.ApplyError{Zones: []*dnsprovider.ZoneError{{Zone: "abion.test", Err: errors.Join(&dnsprovider.EndpointError{Endpoint: rejected.Endpoint, Err: dnsprovider.ErrDuplicateTarget})}}}, http.StatusUnprocessableEntity},
+		{"rejected and failed zones", &dnsprovider.ApplyError{Zones: []*dnsprovider.ZoneError{
+			{Zone: "a.test", Err: errors.Join(rejected)},
+			{Zone: "b.test", Err: errors.Join(errors.New("unexpected response"))},
+		}}, http.StatusInternalServerError},
+		{"abion api 4xx", &dnsprovider.ZoneError{Zone: "abion.test", Err: &internal.Error{Status: 403, Message: "Forbidden"}}, http.StatusForbidden},
+		{"other error", errors.New("unexpected response"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, errorStatusCode(tc.err))
+		})
+	}
+}
+
+func Test_writeProviderError(t *testing.T) {
+	serverErr := &internal.Error{Status: 503, Message: "Service Unavailable"}
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+		body   errorResponse
+	}{
+		{
+			name:   "transient error of a zone",
+			err:    dnsprovider.NewSoftError(&dnsprovider.ZoneError{Zone: "abion.test", Err: serverErr}),
+			status: http.StatusServiceUnavailable,
+			body:   errorResponse{Zone: "abion.test", Reason: "zone abion.test: api error: status=503, message=Service Unavailable"},
+		},
+		{
+			name:   "abion api 4xx",
+			err:    &dnsprovider.ZoneError{Zone: "abion.test", Err: &internal.Error{Status: 404, Message: "Not Found"}},
+			status: http.StatusNotFound,
+			body:   errorResponse{Zone: "abion.test", Reason: "zone abion.test: api error: status=404, message=Not Found"},
+		},
+		{
+			name:   "unexpected error",
+			err:    errors.New("unexpected response"),
+			status: http.StatusInternalServerError,
+			body:   errorResponse{Reason: "unexpected response"},
+		},
+		{
+			name: "several zones",
+			err: &dnsprovider.ApplyError{Zones: []*dnsprovider.ZoneError{
+				{Zone: "a.test", Err: errors.New("unexpected response")},
+				{Zone: "b.test", Err: &internal.Error{Status: 400, Message: "Bad Request"}},
+			}},
+			status: http.StatusBadRequest,
+			body: errorResponse{
+				Zone:   "a.test",
+				Zones:  []string{"a.test", "b.test"},
+				Reason: "changes of 2 zone(s) failed: zone a.test: unexpected response; zone b.test: api error: status=400, message=Bad Request",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := New(&errorProvider{err: tc.err})
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/records", nil),
+				httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(`{}`)),
+			} {
+				req.Header.Set(acceptHeader, testMediaType)
+				req.Header.Set(contentTypeHeader, testMediaType)
+				rec := httptest.NewRecorder()
+				if req.Method == http.MethodGet {
+					w.Records(rec, req)
+				} else {
+					w.ApplyChanges(rec, req)
+				}
+
+				assert.Equal(t, tc.status, rec.Code, req.Method)
+				assert.Equal(t, contentTypeJSON, rec.Header().Get(contentTypeHeader))
+				var body errorResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+				assert.Equal(t, tc.body, body, req.Method)
+			}
+		})
+	}
+}
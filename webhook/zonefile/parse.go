@@ -0,0 +1,321 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+)
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+type line struct {
+	number     int
+	blankOwner bool
+	tokens     []token
+	comment    string
+}
+
+// Parse reads an RFC 1035 master file for the given zone and returns its
+// records keyed by name and type, using the same relative names as the Abion
+// API (`@` for the apex). Owner and target names are resolved against
+// $ORIGIN, which defaults to the zone. SOA records are skipped as they are
+// managed by Abion. Records without TTL get the $TTL value, or defaultTTL
+// if the file has no $TTL directive. The `;` comments of a record, e.g. at the
+// end of its line, become its comments; comments on lines of their own are
+// ignored.
+func Parse(r io.Reader, zone string, defaultTTL int) (map[string]map[string][]internal.Record, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := tokenize(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	zoneFQDN := fqdn(zone)
+	origin := zoneFQDN
+	ttl := defaultTTL
+	previousOwner := ""
+	records := make(map[string]map[string][]internal.Record)
+
+	for _, l := range lines {
+		tokens := l.tokens
+
+		if !l.blankOwner && !tokens[0].quoted && strings.HasPrefix(tokens[0].text, "$") {
+			switch strings.ToUpper(tokens[0].text) {
+			case "$ORIGIN":
+				if len(tokens) != 2 {
+					return nil, lineError(l, "$ORIGIN requires a single domain name")
+				}
+				origin = absoluteName(tokens[1].text, origin)
+			case "$TTL":
+				if len(tokens) != 2 {
+					return nil, lineError(l, "$TTL requires a single TTL value")
+				}
+				if ttl, err = parseTTL(tokens[1].text); err != nil {
+					return nil, lineError(l, err.Error())
+				}
+			default:
+				return nil, lineError(l, fmt.Sprintf("unsupported directive %s", tokens[0].text))
+			}
+			continue
+		}
+
+		owner := previousOwner
+		if !l.blankOwner {
+			owner = absoluteName(tokens[0].text, origin)
+			tokens = tokens[1:]
+		}
+		if owner == "" {
+			return nil, lineError(l, "record without owner name")
+		}
+		previousOwner = owner
+
+		recordTTL := ttl
+		for i := 0; i < 2 && len(tokens) > 0; i++ {
+			if t, err := parseTTL(tokens[0].text); err == nil {
+				recordTTL = t
+				tokens = tokens[1:]
+			} else if strings.EqualFold(tokens[0].text, classIN) {
+				tokens = tokens[1:]
+			}
+		}
+		if len(tokens) == 0 {
+			return nil, lineError(l, "missing record type")
+		}
+
+		recordType := strings.ToUpper(tokens[0].text)
+		rdata := tokens[1:]
+		if recordType == recordTypeSOA {
+			continue
+		}
+		if len(rdata) == 0 {
+			return nil, lineError(l, fmt.Sprintf("missing rdata for %s record", recordType))
+		}
+
+		name, err := relativeName(owner, zoneFQDN)
+		if err != nil {
+			return nil, lineError(l, err.Error())
+		}
+		data, err := parseData(recordType, rdata, origin)
+		if err != nil {
+			return nil, lineError(l, err.Error())
+		}
+
+		if records[name] == nil {
+			records[name] = make(map[string][]internal.Record)
+		}
+		records[name][recordType] = append(records[name][recordType], internal.Record{Data: data, TTL: recordTTL, Comments: l.comment})
+	}
+
+	return records, nil
+}
+
+func parseData(recordType string, rdata []token, origin string) (string, error) {
+	if recordType == recordTypeTXT {
+		var b strings.Builder
+		for _, t := range rdata {
+			b.WriteString(t.text)
+		}
+		return b.String(), nil
+	}
+
+	fields := make([]string, 0, len(rdata))
+	for _, t := range rdata {
+		if t.quoted {
+			fields = append(fields, quote(t.text))
+		} else {
+			fields = append(fields, t.text)
+		}
+	}
+
+	if i, ok := nameFields[recordType]; ok {
+		if i >= len(fields) {
+			return "", fmt.Errorf("%s record requires at least %d rdata fields", recordType, i+1)
+		}
+		fields[i] = absoluteName(fields[i], origin)
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// absoluteName resolves a possibly relative name against the origin.
+func absoluteName(name, origin string) string {
+	switch {
+	case name == apex:
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(name)
+	default:
+		return strings.ToLower(name) + "." + origin
+	}
+}
+
+// relativeName returns the name relative to the zone, `@` for the apex. Names
+// outside the zone result in an error.
+func relativeName(name, zoneFQDN string) (string, error) {
+	name = strings.ToLower(name)
+	zoneFQDN = strings.ToLower(zoneFQDN)
+	if name == zoneFQDN {
+		return apex, nil
+	}
+	if label, ok := strings.CutSuffix(name, "."+zoneFQDN); ok && label != "" {
+		return label, nil
+	}
+	return "", fmt.Errorf("name %s is outside of zone %s", name, zoneFQDN)
+}
+
+// parseTTL parses a TTL in seconds or in BIND unit notation, e.g. 1h30m.
+func parseTTL(s string) (int, error) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	if ttl, err := strconv.Atoi(s); err == nil {
+		return ttl, nil
+	}
+
+	total, value := 0, 0
+	digits := false
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			value = value*10 + int(c-'0')
+			digits = true
+			continue
+		}
+		unit, ok := map[rune]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}[c]
+		if !ok || !digits {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		total += value * unit
+		value, digits = 0, false
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	return total, nil
+}
+
+// tokenize splits the master file into logical lines, joining lines within
+// parentheses. The comments within a logical line are joined with spaces.
+func tokenize(input string) ([]line, error) {
+	var lines []line
+	current := line{number: 1}
+	lineNumber := 1
+	depth := 0
+	atLineStart := true
+
+	flush := func() {
+		if len(current.tokens) > 0 {
+			lines = append(lines, current)
+		}
+		current = line{number: lineNumber}
+	}
+
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == '\n':
+			lineNumber++
+			if depth == 0 {
+				flush()
+				atLineStart = true
+			}
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			if atLineStart && depth == 0 {
+				current.blankOwner = true
+			}
+			i++
+		case c == ';':
+			start := i + 1
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+			if comment := strings.TrimSpace(input[start:i]); comment != "" {
+				current.comment = strings.TrimSpace(current.comment + " " + comment)
+			}
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: unbalanced parentheses", lineNumber)
+			}
+			depth--
+			i++
+		case c == '"':
+			text, n, err := readQuoted(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			current.tokens = append(current.tokens, token{text: text, quoted: true})
+			i += n
+		default:
+			start := i
+			for i < len(input) && !strings.ContainsRune(" \t\r\n;()\"", rune(input[i])) {
+				if input[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			current.tokens = append(current.tokens, token{text: input[start:min(i, len(input))]})
+		}
+		atLineStart = false
+	}
+
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses at end of file")
+	}
+	flush()
+	return lines, nil
+}
+
+// readQuoted reads a quoted character-string, resolving \X and \DDD escapes.
+// It returns the unquoted text and the number of bytes consumed.
+func readQuoted(input string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(input); i++ {
+		c := input[i]
+		switch c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\n':
+			return "", 0, errors.New("unterminated quoted string")
+		case '\\':
+			i++
+			if i >= len(input) {
+				return "", 0, errors.New("unterminated quoted string")
+			}
+			if i+2 < len(input) && isDigit(input[i]) && isDigit(input[i+1]) && isDigit(input[i+2]) {
+				v, _ := strconv.Atoi(input[i : i+3])
+				if v > 255 {
+					return "", 0, fmt.Errorf("invalid escape \\%s", input[i:i+3])
+				}
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+			b.WriteByte(input[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lineError(l line, msg string) error {
+	return fmt.Errorf("line %d: %s", l.number, msg)
+}
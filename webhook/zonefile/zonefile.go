@@ -0,0 +1,133 @@
+package zonefile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+)
+
+const (
+	apex               = "@"
+	maxCharacterString = 255
+	classIN            = "IN"
+	recordTypeTXT      = "TXT"
+	recordTypeSOA      = "SOA"
+)
+
+// nameFields holds the index of the rdata fields containing a domain name,
+// which are qualified with the origin on import if relative.
+var nameFields = map[string]int{
+	"CNAME": 0,
+	"DNAME": 0,
+	"NS":    0,
+	"PTR":   0,
+	"MX":    1,
+	"SRV":   3,
+}
+
+// Write writes the records of a zone as an RFC 1035 master file. Records
+// without TTL are written without one and use the $TTL default. Record comments
+// are written as `;` comments at the end of the record line, with line breaks
+// replaced by spaces.
+func Write(w io.Writer, zone string, records map[string]map[string][]internal.Record, defaultTTL int) error {
+	origin := fqdn(zone)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "; zone %s exported from Abion\n", zone)
+	fmt.Fprintf(&b, "$ORIGIN %s\n", origin)
+	if defaultTTL > 0 {
+		fmt.Fprintf(&b, "$TTL %d\n", defaultTTL)
+	}
+
+	for _, name := range sortedNames(records) {
+		recordTypes := records[name]
+		types := make([]string, 0, len(recordTypes))
+		for t := range recordTypes {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+
+		for _, recordType := range types {
+			for _, record := range recordTypes[recordType] {
+				ttl := ""
+				if record.TTL > 0 {
+					ttl = fmt.Sprintf("%d", record.TTL)
+				}
+				fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%s", name, ttl, classIN, recordType, formatData(recordType, record.Data))
+				if record.Comments != "" {
+					fmt.Fprintf(&b, "\t; %s", formatComment(record.Comments))
+				}
+				b.WriteByte('\n')
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sortedNames returns the record names with the apex first, followed by the
+// other names in alphabetical order.
+func sortedNames(records map[string]map[string][]internal.Record) []string {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == apex || names[j] == apex {
+			return names[i] == apex && names[j] != apex
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// formatData returns the zone file representation of the rdata. TXT data is
+// written as one or more quoted character-strings of at most 255 bytes, split
+// between UTF-8 characters.
+func formatData(recordType, data string) string {
+	if !strings.EqualFold(recordType, recordTypeTXT) {
+		return data
+	}
+
+	var parts []string
+	for len(data) > maxCharacterString {
+		n := maxCharacterString
+		for n > 0 && !utf8.RuneStart(data[n]) {
+			n--
+		}
+		if n == 0 {
+			n = maxCharacterString
+		}
+		parts = append(parts, quote(data[:n]))
+		data = data[n:]
+	}
+	parts = append(parts, quote(data))
+	return strings.Join(parts, " ")
+}
+
+// commentLineBreaks replaces the line breaks of record comments, which would
+// end the `;` comment.
+var commentLineBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// formatComment returns the comment on a single line.
+func formatComment(comment string) string {
+	return commentLineBreaks.Replace(comment)
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
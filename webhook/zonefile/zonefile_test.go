@@ -0,0 +1,118 @@
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/abiondevelopment/external-dns-webhook-abion/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse(t *testing.T) {
+	input := `; example zone
+$ORIGIN example.com.
+$TTL 1h
+@       IN  SOA ns1.example.com. hostmaster.example.com. (
+                2024010101 ; serial
+                3600 900 604800 300 )
+@           IN  A      192.0.2.1  ; web server
+            IN  MX     10 mail
+www   300   IN  CNAME  @
+mail.example.com. A    192.0.2.2
+txt         TXT        "part one " "part \"two\""
+_sip._tcp   SRV        10 60 5060 sip
+$ORIGIN sub.example.com.
+host        60s AAAA   2001:db8::1
+`
+
+	records, err := Parse(strings.NewReader(input), "example.com", 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string][]internal.Record{
+		"@": {
+			"A":  {{Data: "192.0.2.1", TTL: 3600, Comments: "web server"}},
+			"MX": {{Data: "10 mail.example.com.", TTL: 3600}},
+		},
+		"www":       {"CNAME": {{Data: "example.com.", TTL: 300}}},
+		"mail":      {"A": {{Data: "192.0.2.2", TTL: 3600}}},
+		"txt":       {"TXT": {{Data: `part one part "two"`, TTL: 3600}}},
+		"_sip._tcp": {"SRV": {{Data: "10 60 5060 sip.example.com.", TTL: 3600}}},
+		"host.sub":  {"AAAA": {{Data: "2001:db8::1", TTL: 60}}},
+	}, records)
+}
+
+func Test_Parse_Errors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"name outside zone", "www.other.com. A 192.0.2.1\n"},
+		{"lookalike suffix", "www.notexample.com. A 192.0.2.1\n"},
+		{"unbalanced parentheses", "@ SOA ns1 hostmaster ( 1 2 3\n"},
+		{"unterminated string", "@ TXT \"abc\n"},
+		{"missing rdata", "@ 300 A\n"},
+		{"unsupported directive", "$INCLUDE other.zone\n"},
+		{"blank owner on first record", "   A 192.0.2.1\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.input), "example.com", 0)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_WriteParseRoundTrip(t *testing.T) {
+	records := map[string]map[string][]internal.Record{
+		"@": {
+			"A":   {{Data: "192.0.2.1", TTL: 300, Comments: "managed-by=external-dns; owner=default"}},
+			"TXT": {{Data: `"heritage=external-dns,external-dns/owner=default"`, TTL: 300}},
+			"MX":  {{Data: "10 mail.example.com.", TTL: 3600}},
+		},
+		"dkim._domainkey": {
+			"TXT": {{Data: "v=DKIM1; k=rsa; p=" + strings.Repeat("A", 400), TTL: 3600}},
+		},
+		"www": {
+			"CNAME": {{Data: "example.com.", Comments: "flattened\nfrom lb.example.net"}},
+		},
+		"txt": {
+			"TXT": {{Data: strings.Repeat("ü", 200), TTL: 300}},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "example.com", records, 3600))
+	assert.True(t, strings.HasPrefix(strings.SplitN(buf.String(), "\n", 4)[3], "@\t"), "apex records written first")
+
+	parsed, err := Parse(&buf, "example.com", 0)
+	assert.NoError(t, err)
+
+	records["www"]["CNAME"][0].TTL = 3600 // written without TTL, read back with $TTL
+	records["www"]["CNAME"][0].Comments = "flattened from lb.example.net"
+	assert.Equal(t, records, parsed)
+}
+
+func Test_formatData(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{"short", "v=spf1 -all", []string{"v=spf1 -all"}},
+		{"split", strings.Repeat("a", 300), []string{strings.Repeat("a", 255), strings.Repeat("a", 45)}},
+		{"split between characters", strings.Repeat("a", 254) + "üb", []string{strings.Repeat("a", 254), "üb"}},
+		{"multi-byte characters", strings.Repeat("€", 100), []string{strings.Repeat("€", 85), strings.Repeat("€", 15)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expected []string
+			for _, part := range tc.expected {
+				expected = append(expected, quote(part))
+			}
+			assert.Equal(t, strings.Join(expected, " "), formatData("TXT", tc.data))
+		})
+	}
+}